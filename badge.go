@@ -0,0 +1,59 @@
+package rebecca
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BadgeFunc returns a markdown badge for the package. Kind is one of "godoc",
+// "goreport", "license" or "coverage". License and coverage badges need a
+// github.com package path, unless CoverageImageURL and CoverageLinkURL are
+// set. It panics if the badge can't be made.
+func (m *CodeMap) BadgeFunc(kind string) string {
+	out, err := m.Badge(kind)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Badge returns a markdown badge for the package. See BadgeFunc.
+func (m *CodeMap) Badge(kind string) (string, error) {
+	switch kind {
+	case "godoc":
+		return fmt.Sprintf("[![Go Reference](https://pkg.go.dev/badge/%s.svg)](https://pkg.go.dev/%s)", m.pkg, m.pkg), nil
+	case "goreport":
+		return fmt.Sprintf("[![Go Report Card](https://goreportcard.com/badge/%s)](https://goreportcard.com/report/%s)", m.pkg, m.pkg), nil
+	case "license":
+		repo, ok := githubRepo(m.pkg)
+		if !ok {
+			return "", fmt.Errorf("license badge needs a github.com package, found %s", m.pkg)
+		}
+		return fmt.Sprintf("[![License](https://img.shields.io/github/license/%s)](https://github.com/%s/blob/HEAD/LICENSE)", repo, repo), nil
+	case "coverage":
+		image, link := m.CoverageImageURL, m.CoverageLinkURL
+		if image == "" || link == "" {
+			repo, ok := githubRepo(m.pkg)
+			if !ok {
+				return "", fmt.Errorf("coverage badge needs a github.com package or CoverageImageURL and CoverageLinkURL, found %s", m.pkg)
+			}
+			if image == "" {
+				image = fmt.Sprintf("https://coveralls.io/repos/github/%s/badge.svg?branch=master", repo)
+			}
+			if link == "" {
+				link = fmt.Sprintf("https://coveralls.io/github/%s?branch=master", repo)
+			}
+		}
+		return fmt.Sprintf("[![Coverage](%s)](%s)", image, link), nil
+	}
+	return "", fmt.Errorf("unknown badge %s", kind)
+}
+
+// githubRepo returns the "owner/repo" part of a github.com package path.
+func githubRepo(pkg string) (string, bool) {
+	parts := strings.Split(pkg, "/")
+	if len(parts) < 3 || parts[0] != "github.com" {
+		return "", false
+	}
+	return parts[1] + "/" + parts[2], true
+}
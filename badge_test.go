@@ -0,0 +1,39 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBadge(t *testing.T) {
+	m := &CodeMap{pkg: "github.com/dave/rebecca/testing"}
+	tests := map[string]string{
+		"godoc":    "[![Go Reference](https://pkg.go.dev/badge/github.com/dave/rebecca/testing.svg)](https://pkg.go.dev/github.com/dave/rebecca/testing)",
+		"goreport": "[![Go Report Card](https://goreportcard.com/badge/github.com/dave/rebecca/testing)](https://goreportcard.com/report/github.com/dave/rebecca/testing)",
+		"license":  "[![License](https://img.shields.io/github/license/dave/rebecca)](https://github.com/dave/rebecca/blob/HEAD/LICENSE)",
+		"coverage": "[![Coverage](https://coveralls.io/repos/github/dave/rebecca/badge.svg?branch=master)](https://coveralls.io/github/dave/rebecca?branch=master)",
+	}
+	for kind, expected := range tests {
+		found, err := m.Badge(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Kind: %s. Expected %s. Found %s.", kind, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Badge("stars"); err == nil {
+		t.Fatal("Expected error for unknown badge.")
+	}
+
+	m = &CodeMap{pkg: "example.com/foo"}
+	if _, err := m.Badge("license"); err == nil {
+		t.Fatal("Expected error for non github package.")
+	}
+	m.CoverageImageURL = "https://codecov.io/gh/foo/badge.svg"
+	m.CoverageLinkURL = "https://codecov.io/gh/foo"
+	expected := "[![Coverage](https://codecov.io/gh/foo/badge.svg)](https://codecov.io/gh/foo)"
+	if found := m.BadgeFunc("coverage"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
@@ -0,0 +1,336 @@
+package rebecca
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type blockKind int
+
+const (
+	proseBlock blockKind = iota
+	codeBlock
+	headingBlock
+	listBlock
+)
+
+// docBlock is a span of lines in a doc comment: prose, which is rendered
+// verbatim, a preformatted code block, or (when rendering markdown) a heading
+// or list.
+type docBlock struct {
+	kind  blockKind
+	lines []string
+	// blank is true if the block is preceded by a blank line.
+	blank bool
+}
+
+// docRenderer renders the blocks of a doc comment.
+type docRenderer struct {
+	format Format
+	// markdown converts headings and lists, see parseBlocks.
+	markdown bool
+	// linkify wraps bare URLs in prose and lists, see linkify.
+	linkify bool
+	// fenceChar and fenceLang are used for markdown code blocks, as
+	// CodeMap.FenceChar and CodeMap.FenceLang, but without a default language.
+	fenceChar rune
+	fenceLang string
+	// resolve returns the URL of the target of a doc link, e.g. Conn.Close,
+	// or an empty string if it can't be resolved. Doc links in prose and lists
+	// are only converted if it is set.
+	resolve func(target string) string
+}
+
+// render renders the doc comment text. This is the conversion used by DocFunc
+// and CommentToMarkdown.
+func (r docRenderer) render(text string) string {
+	return strings.Trim(r.renderBlocks(parseBlocks(text, r.markdown)), "\n")
+}
+
+// inline converts the URLs and doc links in s, the text of prose or a list
+// item, which has already been escaped in HTML.
+func (r docRenderer) inline(s string) string {
+	if r.linkify {
+		s = linkify(s, r.format)
+	}
+	if r.resolve != nil {
+		s = docLinks(s, r.format, r.resolve)
+	}
+	return s
+}
+
+// text returns the block rendered in r.format. Code blocks are de-indented and
+// fenced. In HTML the text is escaped, but prose isn't wrapped in a paragraph
+// so that it can be split into sentances.
+func (r docRenderer) text(b docBlock) string {
+	f := r.format
+	switch b.kind {
+	case codeBlock:
+		code := strings.Join(deindent(b.lines), "\n")
+		switch f {
+		case AsciiDoc:
+			return "----\n" + code + "\n----"
+		case RST:
+			return "::\n\n" + indent(code, rstIndent)
+		case HTML:
+			return "<pre><code>" + html.EscapeString(code) + "</code></pre>"
+		}
+		char := r.fenceChar
+		if char == 0 {
+			char = '`'
+		}
+		fence := strings.Repeat(string(char), 3)
+		return fence + r.fenceLang + "\n" + code + "\n" + fence
+	case headingBlock:
+		text := strings.TrimPrefix(b.lines[0], "# ")
+		switch f {
+		case AsciiDoc:
+			return "=== " + text
+		case RST:
+			return text + "\n" + strings.Repeat("-", utf8.RuneCountInString(text))
+		case HTML:
+			return "<h3>" + html.EscapeString(text) + "</h3>"
+		}
+		return "### " + text
+	case listBlock:
+		var items, markers []string
+		for _, l := range b.lines {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			if m := listRegex.FindStringSubmatch(l); m != nil {
+				items = append(items, strings.TrimSpace(l[len(m[0]):]))
+				markers = append(markers, m[1])
+				continue
+			}
+			if len(items) == 0 {
+				items = append(items, strings.TrimSpace(l))
+				markers = append(markers, "")
+				continue
+			}
+			// continuation of the previous item
+			items[len(items)-1] += " " + strings.TrimSpace(l)
+		}
+		if f == HTML {
+			tag := "ul"
+			if unicode.IsDigit(rune(markers[0][0])) {
+				tag = "ol"
+			}
+			out := "<" + tag + ">\n"
+			for _, item := range items {
+				out += "<li>" + r.inline(html.EscapeString(item)) + "</li>\n"
+			}
+			return out + "</" + tag + ">"
+		}
+		for i, marker := range markers {
+			items[i] = r.inline(items[i])
+			if marker != "" {
+				items[i] = listMarker(marker, f) + " " + items[i]
+			}
+		}
+		return strings.Join(items, "\n")
+	}
+	if f == HTML {
+		return r.inline(html.EscapeString(strings.Join(b.lines, "\n")))
+	}
+	return r.inline(strings.Join(b.lines, "\n"))
+}
+
+// listMarker converts the marker of a godoc list item to format f.
+func listMarker(marker string, f Format) string {
+	ordered := unicode.IsDigit(rune(marker[0]))
+	switch {
+	case f == AsciiDoc && ordered:
+		return "."
+	case f == AsciiDoc:
+		return "*"
+	case ordered:
+		return strings.TrimRight(marker, ".)") + "."
+	}
+	return "-"
+}
+
+// listRegex matches the first line of a godoc list item.
+var listRegex = regexp.MustCompile(`^\s*([-*+•]|\d+[.)])\s`)
+
+// parseBlocks splits a doc comment into blocks of prose and code. As in godoc,
+// a span of indented lines is preformatted code, unless it starts with a list
+// marker, in which case it is a list. If markdown is false lists are kept as
+// prose, otherwise they become list blocks and headings are detected using the
+// godoc rules.
+func parseBlocks(comment string, markdown bool) []docBlock {
+	var blocks []docBlock
+	var blank bool
+	lines := strings.Split(comment, "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			blank = true
+			continue
+		}
+		if !isIndented(lines[i]) {
+			if n := len(blocks); n > 0 && blocks[n-1].kind == proseBlock && !blank {
+				blocks[n-1].lines = append(blocks[n-1].lines, lines[i])
+			} else {
+				blocks = append(blocks, docBlock{lines: []string{lines[i]}, blank: blank})
+			}
+			blank = false
+			continue
+		}
+		// find the end of the indented span, which may contain blank lines
+		end := i + 1
+		for j := i + 1; j < len(lines); j++ {
+			if isIndented(lines[j]) {
+				end = j + 1
+			} else if strings.TrimSpace(lines[j]) != "" {
+				break
+			}
+		}
+		kind := codeBlock
+		if listRegex.MatchString(lines[i]) {
+			kind = listBlock
+		}
+		if kind == listBlock && !markdown {
+			if n := len(blocks); n > 0 && blocks[n-1].kind == proseBlock && !blank {
+				blocks[n-1].lines = append(blocks[n-1].lines, lines[i:end]...)
+			} else {
+				blocks = append(blocks, docBlock{lines: lines[i:end], blank: blank})
+			}
+		} else {
+			blocks = append(blocks, docBlock{kind: kind, lines: lines[i:end], blank: blank})
+		}
+		blank = false
+		i = end - 1
+	}
+	if markdown {
+		for i := range blocks {
+			if isHeading(blocks, i) {
+				blocks[i].kind = headingBlock
+			}
+		}
+	}
+	return blocks
+}
+
+// isHeading reports whether blocks[i] is a heading. Following the godoc rules,
+// a heading is a single line paragraph surrounded by blank lines, either
+// starting with "# ", or (the old syntax) starting with a capital letter,
+// followed by a paragraph and containing no punctuation other than
+// parentheses and commas.
+func isHeading(blocks []docBlock, i int) bool {
+	b := blocks[i]
+	if b.kind != proseBlock || len(b.lines) != 1 || (i > 0 && !b.blank) {
+		return false
+	}
+	var next *docBlock
+	if i+1 < len(blocks) {
+		next = &blocks[i+1]
+		if !next.blank {
+			return false
+		}
+	}
+	line := b.lines[0]
+	if strings.HasPrefix(line, "# ") {
+		return strings.TrimSpace(line[2:]) != ""
+	}
+	if i == 0 || next == nil || next.kind != proseBlock {
+		return false
+	}
+	r := []rune(line)
+	if !unicode.IsUpper(r[0]) || !(unicode.IsLetter(r[len(r)-1]) || unicode.IsDigit(r[len(r)-1])) {
+		return false
+	}
+	if strings.ContainsAny(line, ";:!?+*/=[]{}_^°&§~%#@<\">\\") {
+		return false
+	}
+	for j, c := range line {
+		switch c {
+		case '\'':
+			// allow "'s" only
+			if !strings.HasPrefix(line[j:], "'s") || (j+2 < len(line) && line[j+2] != ' ') {
+				return false
+			}
+		case '.':
+			// allow periods that don't end a word, e.g. "v1.2"
+			if j+1 == len(line) || line[j+1] == ' ' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// renderBlocks renders blocks parsed by parseBlocks in r.format. Except in
+// markdown, where the original spacing is kept, blocks are always separated by
+// a blank line.
+func (r docRenderer) renderBlocks(blocks []docBlock) string {
+	var out string
+	for i, b := range blocks {
+		if i > 0 {
+			out += "\n"
+			if b.blank || r.format != Markdown {
+				out += "\n"
+			}
+		}
+		if r.format == HTML && b.kind == proseBlock {
+			out += "<p>" + r.text(b) + "</p>"
+			continue
+		}
+		out += r.text(b)
+	}
+	return out
+}
+
+func isIndented(line string) bool {
+	return strings.TrimSpace(line) != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+// deindent removes the longest common leading whitespace from lines. Blank
+// lines are ignored when calculating the indent and are emptied.
+func deindent(lines []string) []string {
+	var indent string
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		prefix := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			indent, first = prefix, false
+			continue
+		}
+		for !strings.HasPrefix(prefix, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			out[i] = strings.TrimPrefix(l, indent)
+		}
+	}
+	return out
+}
+
+// CommentToMarkdown converts the text of a doc comment, e.g. from
+// ast.CommentGroup.Text, to markdown as DocFunc does with RenderMarkdown:
+// indented code becomes fenced code blocks, lists and headings are converted,
+// and doc links become links to pkg.go.dev. It doesn't need a CodeMap, so
+// doc links to the package the comment is from, e.g. [Conn.Close], are
+// linked to the documentation of the package with import path pkg for any
+// exported name. If pkg is empty they are left as they are.
+func CommentToMarkdown(text, pkg string) string {
+	return docRenderer{format: Markdown, markdown: true, resolve: func(target string) string {
+		target = strings.TrimPrefix(target, "*")
+		if pkg != "" && localDocLinkRegex.MatchString(target) {
+			return DefaultGodocURL + pkg + "#" + target
+		}
+		return importDocLinkURL(DefaultGodocURL, target)
+	}}.render(text)
+}
+
+// localDocLinkRegex matches the target of a doc link to an exported
+// declaration or method in the same package, e.g. Conn.Close.
+var localDocLinkRegex = regexp.MustCompile(`^\p{Lu}\w*(\.\p{Lu}\w*)?$`)
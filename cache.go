@@ -0,0 +1,100 @@
+package rebecca
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// parseCache holds the files parsed by NewCodeMap and NewRecursiveCodeMap, so
+// scanning an unchanged directory again doesn't parse it again. The cached
+// files share a FileSet, which is used by every CodeMap reading from the
+// cache.
+var parseCache = struct {
+	sync.Mutex
+	fset  *token.FileSet
+	files map[string]cachedFile
+}{}
+
+// cachedFile is a parsed file, or the error from parsing it, and the size and
+// modification time of the file when it was parsed.
+type cachedFile struct {
+	filename string
+	fset     *token.FileSet
+	size     int64
+	modTime  time.Time
+	file     *ast.File
+	err      error
+}
+
+// ClearCache empties the cache of parsed files used by NewCodeMap and
+// NewRecursiveCodeMap. CodeMaps that have already been created are not
+// affected.
+func ClearCache() {
+	parseCache.Lock()
+	defer parseCache.Unlock()
+	parseCache.fset = nil
+	parseCache.files = nil
+}
+
+// cacheFileSet returns the FileSet used by the cached files.
+func cacheFileSet() *token.FileSet {
+	parseCache.Lock()
+	defer parseCache.Unlock()
+	if parseCache.fset == nil {
+		parseCache.fset = token.NewFileSet()
+	}
+	return parseCache.fset
+}
+
+// parseFile parses the file described by info, reading it with read. If m uses
+// the cache and the file hasn't changed since it was last parsed, the cached
+// result is returned.
+func (m *CodeMap) parseFile(filename string, info fs.FileInfo, read func() ([]byte, error)) (*ast.File, error) {
+	if !m.cache {
+		src, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return parser.ParseFile(m.fset, filename, src, parser.ParseComments)
+	}
+	key, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	parseCache.Lock()
+	c, ok := parseCache.files[key]
+	parseCache.Unlock()
+	if ok && c.filename == filename && c.fset == m.fset && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c.file, c.err
+	}
+
+	src, err := read()
+	if err != nil {
+		return nil, err
+	}
+	f, err := parser.ParseFile(m.fset, filename, src, parser.ParseComments)
+
+	parseCache.Lock()
+	defer parseCache.Unlock()
+	if parseCache.fset == m.fset {
+		// the cache hasn't been cleared while parsing
+		if parseCache.files == nil {
+			parseCache.files = map[string]cachedFile{}
+		}
+		parseCache.files[key] = cachedFile{
+			filename: filename,
+			fset:     m.fset,
+			size:     info.Size(),
+			modTime:  info.ModTime(),
+			file:     f,
+			err:      err,
+		}
+	}
+	return f, err
+}
@@ -0,0 +1,151 @@
+package rebecca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "foo.go")
+	if err := os.WriteFile(file, []byte("package foo\n\n// Foo is foo.\nfunc Foo() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scan := func() *CodeMap {
+		m, err := NewCodeMap("example.com/foo", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	first := scan()
+	if second := scan(); second.Decls["Foo"] != first.Decls["Foo"] || second.fset != first.fset {
+		t.Fatal("Expected cached file to be reused.")
+	}
+
+	if err := os.WriteFile(file, []byte("package foo\n\n// Foo is changed.\nfunc Foo() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed := scan()
+	if changed.Decls["Foo"] == first.Decls["Foo"] {
+		t.Fatal("Expected changed file to be parsed again.")
+	}
+	if found, expected := changed.DocFunc("Foo"), "Foo is changed."; found != expected {
+		t.Fatalf("Expected %s. Found %s.", expected, found)
+	}
+
+	ClearCache()
+	if cleared := scan(); cleared.Decls["Foo"] == changed.Decls["Foo"] || cleared.fset == changed.fset {
+		t.Fatal("Expected file to be parsed again after ClearCache.")
+	}
+}
+
+func benchmarkPackage(b *testing.B, files int) string {
+	b.Helper()
+	dir := b.TempDir()
+	for i := 0; i < files; i++ {
+		src := fmt.Sprintf("package foo\n\n// F%d does things. It has a doc.\nfunc F%d(a, b int) int {\n\treturn a + b\n}\n", i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.go", i)), []byte(src), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func BenchmarkNewCodeMap(b *testing.B) {
+	dir := benchmarkPackage(b, 200)
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ClearCache()
+			if _, err := NewCodeMap("example.com/foo", dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewCodeMap("example.com/foo", dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestExampleCache(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "foo_test.go")
+	if err := os.WriteFile(file, []byte("package foo\n\nfunc ExampleFoo() {\n\ta()\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "foo.go"), []byte("package foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewCodeMap("example.com/foo", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, expected := m.ExampleFunc(false)("ExampleFoo"), "```go\na()\n```"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", expected, found)
+	}
+	m.FenceChar = '~'
+	if found, expected := m.ExampleFunc(false)("ExampleFoo"), "~~~go\na()\n~~~"; found != expected {
+		t.Fatalf("Expected the fence to change. Expected %s. Found %s.", expected, found)
+	}
+
+	if err := os.WriteFile(file, []byte("package foo\n\nfunc ExampleFoo() {\n\tb()\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = NewCodeMap("example.com/foo", dir); err != nil {
+		t.Fatal(err)
+	}
+	if found, expected := m.ExampleFunc(false)("ExampleFoo"), "```go\nb()\n```"; found != expected {
+		t.Fatalf("Expected the changed example. Expected %s. Found %s.", expected, found)
+	}
+}
+
+func BenchmarkExample(b *testing.B) {
+	dir := b.TempDir()
+	var body string
+	for i := 0; i < 50; i++ {
+		body += fmt.Sprintf("\tfmt.Println(%d) // print %d\n", i, i)
+	}
+	files := map[string]string{
+		"foo.go":      "package foo\n",
+		"foo_test.go": "package foo\n\nimport \"fmt\"\n\nfunc ExampleFoo() {\n" + body + "}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	m, err := NewCodeMap("example.com/foo", dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 1000; j++ {
+				m.printed = nil
+				m.ExampleFunc(false)("ExampleFoo")
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 1000; j++ {
+				m.ExampleFunc(false)("ExampleFoo")
+			}
+		}
+	})
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"regexp"
 	"strings"
-	"text/template"
 
 	"github.com/dave/gopackages"
 	"github.com/dave/jennifer/jen"
@@ -14,14 +14,54 @@ import (
 )
 
 var flags struct {
-	pkg, input, output, literals string
+	pkg, dir, input, output        string
+	literals                       string
+	exclude, leftDelim, rightDelim string
+	format, goos, goarch           string
+	markers, outputDelim           string
+	includeExamples                string
+	excludeExamples                string
+	linkify, markdown, recursive   bool
+	stripIdent, stripDeprecated    bool
+	exampleDocs                    bool
+	exported                       bool
+	check, run, regions, validate  bool
+	verify, verifyFormat           bool
+	requireOutput                  bool
+	htmlTemplate                   bool
 }
 
 func init() {
 	flag.StringVar(&flags.pkg, "package", "", "Package to scan")
+	flag.StringVar(&flags.dir, "dir", "", "Directory of the package to scan, e.g. for a module outside GOPATH")
 	flag.StringVar(&flags.input, "input", "README.md.tpl", "Input file")
 	flag.StringVar(&flags.output, "output", "", "Output file, defaults to the input without the .tpl suffix")
 	flag.StringVar(&flags.literals, "literals", "", "Output Go file, containing map of doc literals")
+	flag.StringVar(&flags.exclude, "exclude", "", "Regular expression matching file names to skip, e.g. _gen\\.go$")
+	flag.StringVar(&flags.leftDelim, "left", "", "Left template delimiter, defaults to {{")
+	flag.StringVar(&flags.rightDelim, "right", "", "Right template delimiter, defaults to }}")
+	flag.StringVar(&flags.format, "format", "markdown", "Output format, markdown, asciidoc, rst or html")
+	flag.StringVar(&flags.goos, "goos", "", "Only scan files built for this GOOS, defaults to the host")
+	flag.StringVar(&flags.goarch, "goarch", "", "Only scan files built for this GOARCH, defaults to the host")
+	flag.BoolVar(&flags.htmlTemplate, "htmltemplate", false, "Execute the template with html/template, requires -format=html")
+	flag.StringVar(&flags.markers, "markers", "", "Comma separated note markers to recognise without a uid, e.g. PERF for \"PERF: ...\"")
+	flag.StringVar(&flags.outputDelim, "outputdelim", "", "Delimiter of the cells in the output printed by outputtable, defaults to a tab")
+	flag.BoolVar(&flags.linkify, "linkify", false, "Wrap bare URLs in docs as markdown autolinks")
+	flag.BoolVar(&flags.markdown, "markdown", false, "Render headings and lists in docs as markdown")
+	flag.BoolVar(&flags.stripIdent, "stripident", false, "Remove the name of the declaration from the start of docs")
+	flag.BoolVar(&flags.exported, "exported", false, "Skip unexported declarations, so they can't be used by the template")
+	flag.BoolVar(&flags.stripDeprecated, "stripdeprecated", false, "Remove \"Deprecated:\" paragraphs from docs, see the deprecated function")
+	flag.StringVar(&flags.includeExamples, "examples", "", "Comma separated patterns of the examples to scan, e.g. ExampleConn*")
+	flag.StringVar(&flags.excludeExamples, "excludeexamples", "", "Comma separated patterns of the examples to skip, e.g. Example_internal*")
+	flag.BoolVar(&flags.exampleDocs, "exampledocs", false, "Make the doc comments of examples available as e.g. \"Example.Conn.Close\"")
+	flag.BoolVar(&flags.check, "check", false, "Don't write the output, fail with a diff if it is out of date")
+	flag.BoolVar(&flags.run, "run", false, "Allow the help function to build and run the command")
+	flag.BoolVar(&flags.regions, "regions", false, "Only update the regions between rebecca:start and rebecca:end markers in the output")
+	flag.BoolVar(&flags.validate, "validate", false, "Check the names used by the template, and list unused examples and docs, without rendering")
+	flag.BoolVar(&flags.verify, "verify", false, "Run the examples and fail if their output differs from the output comments, requires -run")
+	flag.BoolVar(&flags.verifyFormat, "verifyformat", false, "Fail if the source of any example isn't gofmt-clean")
+	flag.BoolVar(&flags.requireOutput, "requireoutput", false, "Fail if any example has no output comment, so it isn't run by go test")
+	flag.BoolVar(&flags.recursive, "recursive", false, "Also scan subpackages, referenced as e.g. \"client.Connect\"")
 }
 
 func abort(s string, vv ...interface{}) {
@@ -29,6 +69,39 @@ func abort(s string, vv ...interface{}) {
 	os.Exit(2)
 }
 
+// resolvePackage returns the import path and directory of the package to scan
+// from the -package and -dir flags. If the package isn't given it's found in
+// the directory, which defaults to the working directory, from the nearest
+// go.mod or failing that from GOPATH. If only the package is given the
+// directory is found from GOPATH.
+func resolvePackage(pkg, dir string) (string, string, error) {
+	if pkg != "" {
+		if dir == "" {
+			var err error
+			if dir, err = gopackages.GetDirFromPackage(os.Environ(), os.Getenv("GOPATH"), pkg); err != nil {
+				return "", "", fmt.Errorf("can't parse package directory, %s", err.Error())
+			}
+		}
+		return pkg, dir, nil
+	}
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", "", fmt.Errorf("can't auto-detect package, %s", err.Error())
+		}
+	}
+	pkg, err := rebecca.ImportPath(dir)
+	if err != nil {
+		if pkg, err = gopackages.GetPackageFromDir(os.Getenv("GOPATH"), dir); err != nil {
+			return "", "", fmt.Errorf("can't auto-detect package, %s", err.Error())
+		}
+	}
+	if pkg == "" {
+		return "", "", fmt.Errorf("can't find package at %s and no package specified with 'package' flag", dir)
+	}
+	return pkg, dir, nil
+}
+
 func main() {
 	flag.Parse()
 
@@ -44,54 +117,154 @@ func main() {
 		return
 	}
 
-	if flags.pkg == "" {
-		wd, err := os.Getwd()
+	pkg, dir, err := resolvePackage(flags.pkg, flags.dir)
+	if err != nil {
+		abort("%s\n", err.Error())
+		return
+	}
+
+	var options []rebecca.Option
+	if flags.exclude != "" {
+		exclude, err := regexp.Compile(flags.exclude)
 		if err != nil {
-			abort("can't auto-detect package, %s\n", err.Error())
-			return
-		}
-		flags.pkg, err = gopackages.GetPackageFromDir(os.Getenv("GOPATH"), wd)
-		if err != nil {
-			abort("can't auto-detect package, %s\n", err.Error())
-			return
-		} else if flags.pkg == "" {
-			abort("can't find package at current dir (%s) and no package specified with 'package' flag.\n", wd)
+			abort("can't parse exclude, %s\n", err.Error())
 			return
 		}
+		options = append(options, rebecca.WithFileFilter(func(info fs.FileInfo) bool {
+			return !exclude.MatchString(info.Name())
+		}))
 	}
 
-	dir, err := gopackages.GetDirFromPackage(os.Environ(), os.Getenv("GOPATH"), flags.pkg)
-	if err != nil {
-		abort("can't parse package directory, %s\n", err.Error())
-		return
+	if flags.markers != "" {
+		options = append(options, rebecca.WithNoteMarkers(strings.Split(flags.markers, ",")...))
+	}
+	if flags.exported {
+		options = append(options, rebecca.WithExportedOnly())
+	}
+	if flags.includeExamples != "" {
+		options = append(options, rebecca.WithExampleInclude(strings.Split(flags.includeExamples, ",")...))
+	}
+	if flags.excludeExamples != "" {
+		options = append(options, rebecca.WithExampleExclude(strings.Split(flags.excludeExamples, ",")...))
+	}
+	if flags.exampleDocs {
+		options = append(options, rebecca.WithExampleDocs())
+	}
+	if flags.goos != "" || flags.goarch != "" {
+		options = append(options, rebecca.WithPlatform(flags.goos, flags.goarch))
 	}
 
-	m, err := rebecca.NewCodeMap(flags.pkg, dir)
+	newCodeMap := rebecca.NewCodeMap
+	if flags.recursive {
+		newCodeMap = rebecca.NewRecursiveCodeMap
+	}
+	m, err := newCodeMap(pkg, dir, options...)
 	if err != nil {
 		abort("can't init code map, %s\n", err.Error())
 		return
 	}
-
-	funcMap := template.FuncMap{
-		"example":    m.ExampleFunc(false),
-		"code":       m.ExampleFunc(true),
-		"output":     m.OutputFunc,
-		"doc":        m.DocFunc,
-		"playground": m.PlaygroundFunc,
+	for _, err := range m.Errors {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", err.Error())
+	}
+	if m.Format, err = rebecca.ParseFormat(flags.format); err != nil {
+		abort("%s\n", err.Error())
+		return
 	}
+	m.Linkify = flags.linkify
+	m.RenderMarkdown = flags.markdown
+	m.StripIdentPrefix = flags.stripIdent
+	m.StripDeprecated = flags.stripDeprecated
+	m.LeftDelim, m.RightDelim = flags.leftDelim, flags.rightDelim
+	m.AllowRun = flags.run
+	m.HTMLTemplate = flags.htmlTemplate
+	m.OutputDelimiter = flags.outputDelim
 
-	tpl, err := template.New("main").Funcs(funcMap).ParseFiles(flags.input)
-	if err != nil {
-		abort("can't parse template, %s\n", err.Error())
+	if flags.validate {
+		tpl, err := os.ReadFile(flags.input)
+		if err != nil {
+			abort("can't read template, %s\n", err.Error())
+			return
+		}
+		unused, err := m.Unreferenced(string(tpl))
+		if err != nil {
+			abort("%s\n", err.Error())
+			return
+		}
+		for _, name := range unused {
+			fmt.Fprintf(os.Stderr, "WARNING: %s is not used\n", name)
+		}
+		errs := m.Validate(string(tpl))
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
 		return
 	}
 
-	buf := &bytes.Buffer{}
-	if err := tpl.ExecuteTemplate(buf, flags.input, nil); err != nil {
-		abort("can't process template, %s\n", err.Error())
+	if flags.verify {
+		errs := m.VerifyExamples()
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+	}
+
+	if flags.requireOutput {
+		names := m.ExamplesWithoutOutput()
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "ERROR: %s has no output comment\n", name)
+		}
+		if len(names) > 0 {
+			os.Exit(1)
+		}
+	}
+
+	if flags.verifyFormat {
+		errs := m.VerifyExamplesFormatted()
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+	}
+
+	var out string
+	if flags.regions {
+		existing, err := os.ReadFile(flags.output)
+		if err != nil {
+			abort("can't read output, %s\n", err.Error())
+			return
+		}
+		out, err = rebecca.UpdateRegions(string(existing), m)
+		if err != nil {
+			abort("%s\n", err.Error())
+			return
+		}
+	} else {
+		out, err = rebecca.Render(flags.input, m)
+		if err != nil {
+			abort("%s\n", err.Error())
+			return
+		}
+	}
+	if flags.check {
+		ok, diff, err := rebecca.Compare(flags.output, out)
+		if err != nil {
+			abort("%s\n", err.Error())
+			return
+		}
+		if !ok {
+			fmt.Fprint(os.Stderr, diff)
+			os.Exit(1)
+		}
 		return
 	}
-	if err := os.WriteFile(flags.output, buf.Bytes(), 0644); err != nil {
+	if err := os.WriteFile(flags.output, []byte(out), 0644); err != nil {
 		abort("can't write output, %s\n", err.Error())
 		return
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/dave/rebecca"
+)
+
+func TestResolvePackage(t *testing.T) {
+	// a module outside GOPATH
+	root := t.TempDir()
+	dir := filepath.Join(root, "client")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, "go.mod"):       "module example.com/foo\n\ngo 1.19\n",
+		filepath.Join(dir, "client.go"):     "package client\n\n// Dial connects.\nfunc Dial() {}\n",
+		filepath.Join(dir, "README.md.tpl"): "# {{ \"Dial\" | doc }}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg, found, err := resolvePackage("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != "example.com/foo/client" || found != dir {
+		t.Fatalf("Expected example.com/foo/client in %s. Found %s in %s.", dir, pkg, found)
+	}
+	output := filepath.Join(dir, "README.md")
+	if err := rebecca.Process(filepath.Join(dir, "README.md.tpl"), output, pkg, found); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# Dial connects.\n"; string(out) != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(string(out)))
+	}
+
+	// an explicit package is used as it is
+	if pkg, found, err = resolvePackage("example.com/other", dir); err != nil || pkg != "example.com/other" || found != dir {
+		t.Fatalf("Expected example.com/other in %s. Found %s in %s, %v.", dir, pkg, found, err)
+	}
+}
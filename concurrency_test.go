@@ -0,0 +1,46 @@
+package rebecca
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// TestConcurrentHelpers calls the helpers from several goroutines. Run with
+// -race to check the concurrency contract of CodeMap.
+func TestConcurrentHelpers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go":      {Data: []byte("package foo\n\n// Foo does things. It is fast.\nfunc Foo() {}\n")},
+		"foo_test.go": {Data: []byte("package foo_test\n\nimport \"fmt\"\n\nfunc ExampleFoo() {\n\tfmt.Println(\"a\")\n\t// Output: a\n}\n")},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "abc123")
+	}))
+	defer server.Close()
+	m.PlaygroundShareURL = server.URL
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if found := m.DocFunc("Foo[1]"); found != "It is fast." {
+				t.Errorf("Expected second sentance. Found %s.", found)
+			}
+			if found := m.ExampleFunc(false)("ExampleFoo"); found == "" {
+				t.Error("Expected example.")
+			}
+			if _, err := m.PlaygroundLink("ExampleFoo"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,286 @@
+package rebecca
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ConstValuesFunc returns a table of the exported constants of the named type,
+// e.g. an enum declared with iota, with their values and documentation. It
+// panics if there are none.
+func (m *CodeMap) ConstValuesFunc(typeName string) string {
+	out, err := m.ConstValues(typeName)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// ConstValues returns a table of the constants of the named type. See
+// ConstValuesFunc. Integer, string and boolean expressions of literals, iota
+// and other constants in the package are evaluated. Other values, e.g. calls,
+// are printed as their source. Constants declared without a type have the type
+// of the typed constants in their value, e.g. Both = Read | Write.
+func (m *CodeMap) ConstValues(typeName string) (string, error) {
+	p, name := m.lookup(typeName)
+	consts := p.constValues()
+	var rows [][]string
+	for _, c := range consts {
+		if c.typ != name || !ast.IsExported(c.name) {
+			continue
+		}
+		rows = append(rows, []string{c.name, c.value, strings.Join(strings.Fields(c.doc), " ")})
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no constants of type %s found", typeName)
+	}
+	return m.table([]string{"Name", "Value", "Description"}, rows), nil
+}
+
+// constValue is a constant declared in the package.
+type constValue struct {
+	name, typ, value, doc string
+}
+
+// constValues evaluates the constants declared in the package, in source
+// order. Values that can't be evaluated are printed as the source expression.
+func (m *CodeMap) constValues() []constValue {
+	var decls []*ast.GenDecl
+	typeNames := map[string]bool{}
+	for _, f := range m.files {
+		if strings.HasSuffix(m.fset.File(f.Pos()).Name(), "_test.go") {
+			continue
+		}
+		for _, d := range f.Decls {
+			d, ok := d.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			switch d.Tok {
+			case token.CONST:
+				decls = append(decls, d)
+			case token.TYPE:
+				for _, s := range d.Specs {
+					typeNames[s.(*ast.TypeSpec).Name.Name] = true
+				}
+			}
+		}
+	}
+	// predeclared types, e.g. int, can be converted to, but not builtin
+	// functions, e.g. len
+	for _, name := range types.Universe.Names() {
+		if _, ok := types.Universe.Lookup(name).(*types.TypeName); ok {
+			typeNames[name] = true
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		a, b := m.fset.Position(decls[i].Pos()), m.fset.Position(decls[j].Pos())
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+
+	values := map[string]constant.Value{}
+	types := map[string]string{}
+	var out []constValue
+	for _, d := range decls {
+		// specs with no values repeat the type and values of the previous one
+		var typ ast.Expr
+		var exprs []ast.Expr
+		for iota, s := range d.Specs {
+			s := s.(*ast.ValueSpec)
+			if len(s.Values) > 0 {
+				typ, exprs = s.Type, s.Values
+			}
+			for i, n := range s.Names {
+				c := constValue{name: n.Name, doc: commentText(s.Doc)}
+				if c.doc == "" {
+					c.doc = commentText(s.Comment)
+				}
+				if i >= len(exprs) {
+					out = append(out, c)
+					continue
+				}
+				e := exprs[i]
+				if id, ok := typ.(*ast.Ident); ok {
+					c.typ = id.Name
+				} else if id, ok := conversion(e, typeNames); ok && typ == nil {
+					// a conversion, e.g. Kind(iota)
+					c.typ = id.Name
+				} else if typ == nil {
+					// an expression of typed constants, e.g. Read | Write
+					c.typ = constType(e, types)
+				}
+				types[n.Name] = c.typ
+				if v := evalConst(e, int64(iota), values, typeNames); v.Kind() != constant.Unknown {
+					values[n.Name] = v
+					c.value = constString(v)
+				} else {
+					var buf bytes.Buffer
+					printer.Fprint(&buf, m.fset, e)
+					c.value = buf.String()
+				}
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// constType returns the type of the untyped constant expression e, the type of
+// the typed constants it uses, e.g. Flag for Read | Write. Identifiers are
+// looked up in types. It returns an empty string if e has no known type.
+func constType(e ast.Expr, types map[string]string) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return types[e.Name]
+	case *ast.ParenExpr:
+		return constType(e.X, types)
+	case *ast.UnaryExpr:
+		return constType(e.X, types)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.SHL, token.SHR:
+			return constType(e.X, types)
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			// comparisons are untyped booleans
+			return ""
+		}
+		x, y := constType(e.X, types), constType(e.Y, types)
+		if x == "" {
+			return y
+		}
+		if y != "" && y != x {
+			return ""
+		}
+		return x
+	}
+	return ""
+}
+
+// conversion returns the type converted to if e is a conversion to one of
+// typeNames, e.g. Kind(1). Calls of builtin functions, e.g. len("abc"), aren't
+// conversions.
+func conversion(e ast.Expr, typeNames map[string]bool) (*ast.Ident, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil, false
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok || !typeNames[id.Name] {
+		return nil, false
+	}
+	return id, true
+}
+
+// evalConst evaluates the constant expression e. Identifiers are looked up in
+// values, and conversions are to typeNames. It returns an unknown value if e
+// can't be evaluated.
+func evalConst(e ast.Expr, iota int64, values map[string]constant.Value, typeNames map[string]bool) constant.Value {
+	unknown := constant.MakeUnknown()
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0)
+	case *ast.Ident:
+		switch e.Name {
+		case "iota":
+			return constant.MakeInt64(iota)
+		case "true", "false":
+			return constant.MakeBool(e.Name == "true")
+		}
+		if v, ok := values[e.Name]; ok {
+			return v
+		}
+		return unknown
+	case *ast.ParenExpr:
+		return evalConst(e.X, iota, values, typeNames)
+	case *ast.CallExpr:
+		// conversions to named types, e.g. Kind(1)
+		if _, ok := conversion(e, typeNames); ok {
+			return evalConst(e.Args[0], iota, values, typeNames)
+		}
+		return unknown
+	case *ast.UnaryExpr:
+		x := evalConst(e.X, iota, values, typeNames)
+		if x.Kind() == constant.Unknown {
+			return unknown
+		}
+		switch e.Op {
+		case token.ADD, token.SUB, token.XOR, token.NOT:
+			return constant.UnaryOp(e.Op, x, 0)
+		}
+		return unknown
+	case *ast.BinaryExpr:
+		x, y := evalConst(e.X, iota, values, typeNames), evalConst(e.Y, iota, values, typeNames)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown {
+			return unknown
+		}
+		switch e.Op {
+		case token.SHL, token.SHR:
+			// the shift count may be an untyped float, e.g. 1 << 2.0
+			y = constant.ToInt(y)
+			if x.Kind() != constant.Int || y.Kind() != constant.Int {
+				return unknown
+			}
+			s, ok := constant.Uint64Val(y)
+			if !ok {
+				return unknown
+			}
+			return constant.Shift(x, e.Op, uint(s))
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			if x.Kind() != y.Kind() {
+				return unknown
+			}
+			return constant.MakeBool(constant.Compare(x, e.Op, y))
+		case token.QUO:
+			if y.Kind() != constant.Int && y.Kind() != constant.Float || constant.Sign(y) == 0 {
+				return unknown
+			}
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				// integer division
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+			}
+		case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+			if x.Kind() != constant.Int || y.Kind() != constant.Int {
+				return unknown
+			}
+			if e.Op == token.REM && constant.Sign(y) == 0 {
+				return unknown
+			}
+		}
+		// constant.BinaryOp panics if the operation isn't valid for the
+		// operands
+		switch {
+		case x.Kind() == constant.Bool || y.Kind() == constant.Bool:
+			if x.Kind() != y.Kind() || (e.Op != token.LAND && e.Op != token.LOR) {
+				return unknown
+			}
+		case x.Kind() == constant.String || y.Kind() == constant.String:
+			if x.Kind() != y.Kind() || e.Op != token.ADD {
+				return unknown
+			}
+		case e.Op != token.ADD && e.Op != token.SUB && e.Op != token.MUL && e.Op != token.QUO &&
+			e.Op != token.REM && e.Op != token.AND && e.Op != token.OR && e.Op != token.XOR && e.Op != token.AND_NOT:
+			return unknown
+		}
+		return constant.BinaryOp(x, e.Op, y)
+	}
+	return unknown
+}
+
+// constString formats v as it would be written in Go, e.g. 1 or "foo".
+func constString(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Int, constant.String, constant.Bool:
+		return v.ExactString()
+	}
+	return v.String()
+}
@@ -0,0 +1,131 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+const constsTestFile = `package foo
+
+import "time"
+
+// Kind is the kind of a node.
+type Kind int
+
+const (
+	// Invalid is the zero Kind.
+	Invalid Kind = iota
+	// File is a | separated
+	// file.
+	File
+	Dir // A directory.
+	_
+	Link
+	hidden
+)
+
+// Flag is a bit flag.
+type Flag uint
+
+const (
+	Read Flag = 1 << iota
+	Write
+	Both  = Read | Write
+	Other = Flag(8)
+	Mask  = ^(Both << 1) == 0
+)
+
+// Name is a name.
+type Name string
+
+const (
+	Alice Name = "alice"
+	Bob   Name = "b" + "ob"
+	Now   Name = Name(time.Now)
+)
+`
+
+func TestConstValues(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{"foo.go": constsTestFile})
+	tests := map[string]string{
+		"Kind": "| Name | Value | Description |\n| --- | --- | --- |\n" +
+			"| Invalid | 0 | Invalid is the zero Kind. |\n" +
+			"| File | 1 | File is a \\| separated file. |\n" +
+			"| Dir | 2 | A directory. |\n" +
+			"| Link | 4 |  |",
+		"Flag": "| Name | Value | Description |\n| --- | --- | --- |\n" +
+			"| Read | 1 |  |\n| Write | 2 |  |\n| Both | 3 |  |\n| Other | 8 |  |",
+		"Name": "| Name | Value | Description |\n| --- | --- | --- |\n" +
+			"| Alice | \"alice\" |  |\n| Bob | \"bob\" |  |\n| Now | Name(time.Now) |  |",
+	}
+	for in, expected := range tests {
+		found, err := m.ConstValues(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.ConstValues("Missing"); err == nil || err.Error() != "no constants of type Missing found" {
+		t.Fatalf("Expected error. Found %v.", err)
+	}
+}
+
+func TestConstValuesCalls(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{"foo.go": `package foo
+
+type K int
+
+const (
+	// A is shifted by an untyped float.
+	//
+	//go:generate echo A
+	A K = 1 << 2.0
+	B   = K(len("abc"))
+	C   = len("abc")
+)
+`})
+	expected := "| Name | Value | Description |\n| --- | --- | --- |\n" +
+		"| A | 4 | A is shifted by an untyped float. |\n| B | K(len(\"abc\")) |  |"
+	if found := m.ConstValuesFunc("K"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	for _, c := range m.constValues() {
+		if c.name == "C" && (c.typ != "" || c.value != `len("abc")`) {
+			t.Fatalf("Expected C to be untyped with its source as the value. Found %s %s.", c.typ, c.value)
+		}
+	}
+}
+
+func TestConstValuesFormats(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{"foo.go": `package foo
+
+type Kind int
+
+const (
+	A Kind = iota // The <first>.
+	B
+)
+`})
+	tests := map[Format]string{
+		AsciiDoc: "|===\n| Name | Value | Description\n\n| A | 0 | The <first>.\n| B | 1 |\n|===",
+		RST: ".. list-table::\n   :header-rows: 1\n\n" +
+			"   * - Name\n     - Value\n     - Description\n" +
+			"   * - A\n     - 0\n     - The <first>.\n" +
+			"   * - B\n     - 1\n     -",
+		HTML: "<table>\n<tr><th>Name</th><th>Value</th><th>Description</th></tr>\n" +
+			"<tr><td>A</td><td>0</td><td>The &lt;first&gt;.</td></tr>\n" +
+			"<tr><td>B</td><td>1</td><td></td></tr>\n</table>",
+	}
+	for f, expected := range tests {
+		m.Format = f
+		found, err := m.ConstValues("Kind")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Format: %d. Expected %s. Found %s.", f, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rebecca
+
+import (
+	"fmt"
+	"go/ast"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// DocLinksFunc returns a list of links to the declarations referenced by doc
+// links, e.g. [Conn.Close] or [io.Reader], in the documentation for the named
+// declaration, in the order they first appear. It's useful for a "See also"
+// section. Doc links in code blocks and those that can't be resolved are
+// skipped, and if there are none an empty string is returned. It panics if the
+// declaration is not documented.
+func (m *CodeMap) DocLinksFunc(in string) string {
+	out, err := m.DocLinks(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// DocLinks returns a list of links to the declarations referenced by the
+// documentation for the named declaration. See DocLinksFunc.
+func (m *CodeMap) DocLinks(in string) (string, error) {
+	c, ok := m.comment(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("doc for %s not found", in))
+	}
+	var links []string
+	seen := map[string]bool{}
+	for _, b := range parseBlocks(c, true) {
+		if b.kind == codeBlock {
+			// as in DocFunc, doc links in code are just code
+			continue
+		}
+		s := strings.Join(b.lines, "\n")
+		for _, span := range docLinkSpans(s) {
+			text := s[span[2]:span[3]]
+			u := m.docLinkURL(text)
+			if u == "" || seen[text] {
+				continue
+			}
+			seen[text] = true
+			links = append(links, formatLink(text, u, m.Format))
+		}
+	}
+	if len(links) == 0 {
+		return "", nil
+	}
+	if m.Format == HTML {
+		return "<ul>\n<li>" + strings.Join(links, "</li>\n<li>") + "</li>\n</ul>", nil
+	}
+	marker := listMarker("-", m.Format) + " "
+	return marker + strings.Join(links, "\n"+marker), nil
+}
+
+// docLinkTargetRegex matches a doc link candidate. docLinkSpans checks the
+// characters around it.
+var docLinkTargetRegex = regexp.MustCompile(`\[(\*?[\w./]+)\]`)
+
+// docLinkSpans returns the submatch indexes of the doc links in s. As in
+// godoc, a doc link must not be next to a letter or digit, e.g. a[i], and
+// markdown links and link definitions, e.g. [text](url) and [text]: url, are
+// skipped.
+func docLinkSpans(s string) [][]int {
+	var out [][]int
+	for _, span := range docLinkTargetRegex.FindAllStringSubmatchIndex(s, -1) {
+		if span[0] > 0 && (isWordByte(s[span[0]-1]) || s[span[0]-1] == ']') {
+			continue
+		}
+		if span[1] < len(s) && (isWordByte(s[span[1]]) || strings.IndexByte("([:", s[span[1]]) >= 0) {
+			continue
+		}
+		out = append(out, span)
+	}
+	return out
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 0x80 || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// docLinks converts the doc links in s to links in format f, to the URLs
+// returned by resolve. As in godoc, links that can't be resolved, where
+// resolve returns an empty string, are left as they are, brackets included.
+func docLinks(s string, f Format, resolve func(target string) string) string {
+	var out string
+	var last int
+	for _, span := range docLinkSpans(s) {
+		u := resolve(s[span[2]:span[3]])
+		if u == "" {
+			continue
+		}
+		out += s[last:span[0]] + formatLink(s[span[2]:span[3]], u, f)
+		last = span[1]
+	}
+	return out + s[last:]
+}
+
+// docLinkURL returns the URL of the documentation for the target of a doc
+// link, or an empty string if it can't be resolved. As in godoc, the target
+// is a declaration in the package, e.g. Conn.Close, an exported declaration
+// in another package, e.g. io.Reader or encoding/json.Decoder, or an import
+// path containing a slash, e.g. encoding/json. Declarations in subpackages
+// scanned by NewRecursiveCodeMap are found by their path, e.g. client.Dial.
+func (m *CodeMap) docLinkURL(target string) string {
+	target = strings.TrimPrefix(target, "*")
+	if p, name := m.lookup(target); name != "" {
+		_, documented := p.Comments[name]
+		_, declared := p.Decls[name]
+		if documented || declared {
+			return m.godocURL() + p.pkg + "#" + name
+		}
+	}
+	return importDocLinkURL(m.godocURL(), target)
+}
+
+// importDocLinkURL returns the URL under base of the documentation for the
+// target of a doc link to another package, or an empty string if target isn't
+// an exported declaration in a package or an import path containing a slash.
+func importDocLinkURL(base, target string) string {
+	dir, elem := "", target
+	if i := strings.LastIndex(target, "/"); i >= 0 {
+		dir, elem = target[:i+1], target[i+1:]
+	}
+	pkg, name := elem, ""
+	if i := strings.Index(elem, "."); i >= 0 {
+		pkg, name = elem[:i], elem[i+1:]
+	}
+	switch {
+	case pkg == "" || !unicode.IsLower(rune(pkg[0])):
+		return ""
+	case name == "" && dir != "":
+		return base + dir + pkg
+	case name == "" || !ast.IsExported(name) || strings.HasSuffix(name, "."):
+		return ""
+	}
+	return base + dir + pkg + "#" + name
+}
+
+// formatLink returns a link to u with the given text in format f.
+func formatLink(text, u string, f Format) string {
+	switch f {
+	case AsciiDoc:
+		return u + "[" + text + "]"
+	case RST:
+		return "`" + text + " <" + u + ">`__"
+	case HTML:
+		return `<a href="` + html.EscapeString(u) + `">` + text + "</a>"
+	}
+	return "[" + text + "](" + u + ")"
+}
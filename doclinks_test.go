@@ -0,0 +1,110 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDocLinks(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Conn is a connection. See [Conn.Close], [*Conn] and [Dial].
+type Conn struct{ buf [Size]byte }
+
+// Close closes.
+func (c *Conn) Close() {}
+
+// Size is the buffer size.
+const Size = 8
+
+// Dial wraps an [io.Reader] and [encoding/json.Decoder], see [encoding/json]
+// and [Missing]. Not links: a[i], [text](https://example.com), [lower.case]
+// and [Conn.Close]x.
+//
+//	x := buf[Size]
+//	c.Close() // see [Conn.Close]
+func Dial() {}
+
+// Cite is described in [1] and takes [optional] args, see [Conn.Close] and
+// https://example.com/cite.
+func Cite() {}
+
+// Plain has no doc links.
+func Plain() {}
+`,
+	})
+	m.RenderMarkdown = true
+	tests := map[string]string{
+		"Conn": "Conn is a connection. See [Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close), " +
+			"[*Conn](https://pkg.go.dev/example.com/foo#Conn) and [Dial](https://pkg.go.dev/example.com/foo#Dial).",
+		"Dial": "Dial wraps an [io.Reader](https://pkg.go.dev/io#Reader) and " +
+			"[encoding/json.Decoder](https://pkg.go.dev/encoding/json#Decoder), see " +
+			"[encoding/json](https://pkg.go.dev/encoding/json)\nand [Missing]. Not links: a[i], " +
+			"[text](https://example.com), [lower.case]\nand [Conn.Close]x.\n\n```\nx := buf[Size]\nc.Close() // see [Conn.Close]\n```",
+		"Cite": "Cite is described in [1] and takes [optional] args, see " +
+			"[Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close) and\nhttps://example.com/cite.",
+	}
+	for name, expected := range tests {
+		found, err := m.Doc(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+
+	// links and URLs are converted together in each format
+	m.Linkify = true
+	formats := map[Format]string{
+		Markdown: "Cite is described in [1] and takes [optional] args, see " +
+			"[Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close) and\n<https://example.com/cite>.",
+		HTML: "<p>Cite is described in [1] and takes [optional] args, see " +
+			"<a href=\"https://pkg.go.dev/example.com/foo#Conn.Close\">Conn.Close</a> and\n" +
+			"<a href=\"https://example.com/cite\">https://example.com/cite</a>.</p>",
+		AsciiDoc: "Cite is described in [1] and takes [optional] args, see " +
+			"https://pkg.go.dev/example.com/foo#Conn.Close[Conn.Close] and\n<https://example.com/cite>.",
+	}
+	for f, expected := range formats {
+		m.Format = f
+		if found := m.DocFunc("Cite"); found != expected {
+			t.Fatalf("Format: %v. Expected %s. Found %s.", f, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	m.Format, m.Linkify = Markdown, false
+
+	m.RenderMarkdown = false
+	expected := "Conn is a connection. See [Conn.Close], [*Conn] and [Dial]."
+	if found := m.DocFunc("Conn"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+
+	lists := map[string]string{
+		"Conn": "- [Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close)\n" +
+			"- [*Conn](https://pkg.go.dev/example.com/foo#Conn)\n" +
+			"- [Dial](https://pkg.go.dev/example.com/foo#Dial)",
+		"Dial": "- [io.Reader](https://pkg.go.dev/io#Reader)\n" +
+			"- [encoding/json.Decoder](https://pkg.go.dev/encoding/json#Decoder)\n" +
+			"- [encoding/json](https://pkg.go.dev/encoding/json)",
+		"Plain": "",
+	}
+	for name, expected := range lists {
+		if found := m.DocLinksFunc(name); found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+
+	m.Format = HTML
+	expected = `<ul>
+<li><a href="https://pkg.go.dev/io#Reader">io.Reader</a></li>
+<li><a href="https://pkg.go.dev/encoding/json#Decoder">encoding/json.Decoder</a></li>
+<li><a href="https://pkg.go.dev/encoding/json">encoding/json</a></li>
+</ul>`
+	if found := m.DocLinksFunc("Dial"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.DocLinks("Missing"); err == nil {
+		t.Fatal("Expected error for missing declaration.")
+	}
+}
@@ -0,0 +1,107 @@
+package rebecca
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// DefaultEntryParts are the parts printed by EntryFunc when none are given.
+var DefaultEntryParts = []string{"heading", "doc", "signature", "examples"}
+
+// EntryFunc returns a section for the named declaration, made of the parts
+// given, in order:
+//
+//	heading    a heading with the name
+//	synopsis   the first sentance of the documentation
+//	doc        the documentation, as printed by DocFunc
+//	signature  the signature, for functions and methods
+//	decl       the declaration, as printed by DeclFunc
+//	examples   the examples with their output, as printed by
+//	           ExampleWithOutputFunc
+//
+// Parts that don't apply, e.g. the examples of a function that has none, are
+// left out. With no parts, DefaultEntryParts are printed. It panics if the
+// declaration is not found.
+func (m *CodeMap) EntryFunc(in string, parts ...string) string {
+	out, err := m.Entry(in, parts...)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Entry returns a section for the named declaration. See EntryFunc.
+func (m *CodeMap) Entry(in string, parts ...string) (string, error) {
+	p, name := m.lookup(in)
+	_, documented := p.Comments[name]
+	decl, declared := p.Decls[name]
+	if !documented && !declared {
+		return "", m.notFound(in, fmt.Errorf("declaration %s not found", in))
+	}
+	if len(parts) == 0 {
+		parts = DefaultEntryParts
+	}
+	var sections []string
+	for _, part := range parts {
+		var out string
+		var err error
+		switch part {
+		case "heading":
+			out = m.heading(in)
+		case "synopsis":
+			if documented {
+				out, err = m.Synopsis(in)
+			}
+		case "doc":
+			if documented {
+				out, err = m.Doc(in)
+			}
+		case "signature":
+			if isFunc(decl) {
+				out, err = m.Signature(in)
+			}
+		case "decl":
+			if declared {
+				out, err = m.Decl(in)
+			}
+		case "examples":
+			examples := m.ExamplesFor(in)
+			var outs []string
+			for _, e := range examples {
+				text := m.exampleWithOutput(e)
+				if len(examples) > 1 {
+					// as in ExamplesForFunc
+					title := "Example"
+					if _, suffix := splitExampleName(e.Name); suffix != "" {
+						title += " (" + strings.ToUpper(suffix[:1]) + suffix[1:] + ")"
+					}
+					text = m.heading(title) + "\n\n" + text
+				}
+				outs = append(outs, text)
+			}
+			out = strings.Join(outs, "\n\n")
+		default:
+			return "", fmt.Errorf("invalid part %s for %s", part, in)
+		}
+		if err != nil {
+			return "", err
+		}
+		if out != "" {
+			sections = append(sections, out)
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// isFunc reports whether d is a function, method or interface method.
+func isFunc(d ast.Node) bool {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return true
+	case *ast.Field:
+		_, ok := d.Type.(*ast.FuncType)
+		return ok
+	}
+	return false
+}
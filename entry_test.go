@@ -0,0 +1,58 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEntry(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Conn is a connection.
+type Conn struct{}
+
+// Close closes. It really does.
+func (c *Conn) Close() error { return nil }
+
+func Open() {}
+`,
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleConn_Close() {
+	fmt.Println("a")
+	// Output: a
+}
+
+func ExampleConn_Close_timeout() {
+	fmt.Println("b")
+}
+`,
+	})
+	tests := []struct {
+		in       string
+		parts    []string
+		expected string
+	}{
+		{"Conn.Close", nil, "### Conn.Close\n\nClose closes. It really does.\n\n```go\nfunc (c *Conn) Close() error\n```\n\n" +
+			"### Example\n\n```go\nfmt.Println(\"a\")\n```\n\nOutput:\n\n```\na\n```\n\n### Example (Timeout)\n\n```go\nfmt.Println(\"b\")\n```"},
+		{"Conn.Close", []string{"synopsis", "heading"}, "Close closes.\n\n### Conn.Close"},
+		{"Conn", nil, "### Conn\n\nConn is a connection."},
+		{"Conn", []string{"decl"}, "```go\ntype Conn struct{}\n```"},
+		{"Open", nil, "### Open\n\n```go\nfunc Open()\n```"},
+	}
+	for _, test := range tests {
+		found := m.EntryFunc(test.in, test.parts...)
+		if found != test.expected {
+			t.Fatalf("Input: %s %v. Expected %s. Found %s.", test.in, test.parts, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Entry("Missing"); err == nil || err.Error() != "declaration Missing not found" {
+		t.Fatalf("Expected error for Missing. Found %v.", err)
+	}
+	if _, err := m.Entry("Open", "footer"); err == nil || err.Error() != "invalid part footer for Open" {
+		t.Fatalf("Expected error for an invalid part. Found %v.", err)
+	}
+}
@@ -0,0 +1,259 @@
+package rebecca
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Format is the markup language of the rendered output.
+type Format int
+
+const (
+	// Markdown is GitHub flavored markdown.
+	Markdown Format = iota
+	// AsciiDoc is AsciiDoc markup.
+	AsciiDoc
+	// RST is reStructuredText, as used by Sphinx.
+	RST
+	// HTML is HTML, with code and documentation escaped.
+	HTML
+)
+
+// ParseFormat returns the Format with the given name, e.g. "markdown" or
+// "asciidoc", "rst" or "html".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "markdown", "md":
+		return Markdown, nil
+	case "asciidoc", "adoc":
+		return AsciiDoc, nil
+	case "rst", "restructuredtext":
+		return RST, nil
+	case "html":
+		return HTML, nil
+	}
+	return Markdown, fmt.Errorf("unknown format %s", name)
+}
+
+// fence wraps code in a code block. For markdown m.FenceLang and m.FenceChar
+// are used.
+func (m *CodeMap) fence(code string) string {
+	return m.fenceHighlight(code, nil)
+}
+
+// fenceHighlight wraps code in a code block that highlights the ranges of
+// lines, numbered from 1.
+func (m *CodeMap) fenceHighlight(code string, lines [][2]int) string {
+	lang := m.FenceLang
+	if lang == "" {
+		lang = "go"
+	}
+	return m.fenceLang(code, lang, lines)
+}
+
+// fenceLang is fenceHighlight with the language given by lang rather than
+// m.FenceLang.
+func (m *CodeMap) fenceLang(code, lang string, lines [][2]int) string {
+	switch m.Format {
+	case AsciiDoc:
+		var attr string
+		if len(lines) > 0 {
+			attr = ",highlight=" + formatRanges(lines, ";", "..")
+		}
+		return fmt.Sprintf("[source,%s%s]\n----\n%s\n----", lang, attr, code)
+	case RST:
+		var option string
+		if len(lines) > 0 {
+			option = "\n" + rstIndent + ":emphasize-lines: " + formatRanges(lines, ",", "-")
+		}
+		return fmt.Sprintf(".. code-block:: %s%s\n\n%s", lang, option, indent(code, rstIndent))
+	case HTML:
+		var attr string
+		if len(lines) > 0 {
+			// as used by the Prism line highlight plugin
+			attr = fmt.Sprintf(" data-line=\"%s\"", formatRanges(lines, ",", "-"))
+		}
+		return fmt.Sprintf("<pre%s><code class=\"language-%s\">%s</code></pre>", attr, lang, html.EscapeString(code))
+	}
+	if len(lines) > 0 {
+		lang += " {" + formatRanges(lines, ",", "-") + "}"
+	}
+	char := m.FenceChar
+	if char == 0 {
+		char = '`'
+	}
+	f := strings.Repeat(string(char), 3)
+	return fmt.Sprintf("%s%s\n%s\n%s", f, lang, code, f)
+}
+
+// parseHighlight parses a list of lines and ranges of lines to highlight, e.g.
+// "lines=3,5-7", in code with n lines. Ranges are clipped to lines 1 to n, and
+// those outside them, e.g. 0, are dropped. Only malformed specs are errors.
+func parseHighlight(spec string, n int) ([][2]int, error) {
+	var out [][2]int
+	for _, part := range strings.Split(strings.TrimPrefix(spec, "lines="), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			start, end = part[:i], part[i+1:]
+		}
+		a, errA := strconv.Atoi(start)
+		b, errB := strconv.Atoi(end)
+		if errA != nil || errB != nil || b < a {
+			return nil, fmt.Errorf("invalid highlight %s in %s", part, spec)
+		}
+		if b < 1 || a > n {
+			continue
+		}
+		if a < 1 {
+			a = 1
+		}
+		if b > n {
+			b = n
+		}
+		out = append(out, [2]int{a, b})
+	}
+	return out, nil
+}
+
+// formatRanges formats ranges of lines, e.g. "3,5-7".
+func formatRanges(lines [][2]int, sep, to string) string {
+	parts := make([]string, len(lines))
+	for i, r := range lines {
+		if r[0] == r[1] {
+			parts[i] = strconv.Itoa(r[0])
+		} else {
+			parts[i] = strconv.Itoa(r[0]) + to + strconv.Itoa(r[1])
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// heading returns a heading for generated sections, e.g. in ExampleListFunc.
+func (m *CodeMap) heading(text string) string {
+	return docRenderer{format: m.Format}.text(docBlock{kind: headingBlock, lines: []string{text}})
+}
+
+// plainFence wraps text in a code block without a language.
+func (m *CodeMap) plainFence(text string) string {
+	switch m.Format {
+	case AsciiDoc:
+		return fmt.Sprintf("----\n%s\n----", text)
+	case RST:
+		return fmt.Sprintf("::\n\n%s", indent(text, rstIndent))
+	case HTML:
+		return fmt.Sprintf("<pre><code>%s</code></pre>", html.EscapeString(text))
+	}
+	char := m.FenceChar
+	if char == 0 {
+		char = '`'
+	}
+	f := strings.Repeat(string(char), 3)
+	return fmt.Sprintf("%s\n%s\n%s", f, text, f)
+}
+
+// IndentFunc prefixes each line of text with prefix, e.g. to quote the
+// output of another function with {{ doc "Foo" | indent "> " }}, or nest it in
+// a list with "  ". Blank lines get the prefix without trailing whitespace, so
+// a blockquote isn't broken, and a trailing newline is kept without adding a
+// prefix after it.
+func (m *CodeMap) IndentFunc(prefix, text string) string {
+	if text == "" {
+		return ""
+	}
+	trailing := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			lines[i] = strings.TrimRight(prefix, " \t")
+		} else {
+			lines[i] = prefix + l
+		}
+	}
+	out := strings.Join(lines, "\n")
+	if trailing {
+		out += "\n"
+	}
+	return out
+}
+
+// rstIndent is the indent of the content of RST directives and literal blocks.
+const rstIndent = "   "
+
+// indent prefixes each non-blank line of s with prefix.
+func indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			lines[i] = prefix + l
+		} else {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// table returns a table with a header row, e.g. for ConstValuesFunc. Cells
+// must not contain newlines.
+func (m *CodeMap) table(header []string, rows [][]string) string {
+	var b strings.Builder
+	switch m.Format {
+	case AsciiDoc:
+		b.WriteString("|===\n")
+		for i, row := range append([][]string{header}, rows...) {
+			cells := make([]string, len(row))
+			for j, cell := range row {
+				cells[j] = strings.ReplaceAll(cell, "|", "\\|")
+			}
+			b.WriteString(strings.TrimRight("| "+strings.Join(cells, " | "), " ") + "\n")
+			if i == 0 {
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString("|===")
+	case RST:
+		b.WriteString(".. list-table::\n" + rstIndent + ":header-rows: 1\n\n")
+		for _, row := range append([][]string{header}, rows...) {
+			for i, cell := range row {
+				marker := "  - "
+				if i == 0 {
+					marker = "* - "
+				}
+				b.WriteString(strings.TrimRight(rstIndent+marker+cell, " ") + "\n")
+			}
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	case HTML:
+		b.WriteString("<table>\n<tr>")
+		for _, cell := range header {
+			b.WriteString("<th>" + html.EscapeString(cell) + "</th>")
+		}
+		b.WriteString("</tr>\n")
+		for _, row := range rows {
+			b.WriteString("<tr>")
+			for _, cell := range row {
+				b.WriteString("<td>" + html.EscapeString(cell) + "</td>")
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>")
+	default:
+		for i, row := range append([][]string{header}, rows...) {
+			b.WriteString("|")
+			for _, cell := range row {
+				b.WriteString(" " + strings.ReplaceAll(cell, "|", "\\|") + " |")
+			}
+			b.WriteString("\n")
+			if i == 0 {
+				b.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+			}
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return b.String()
+}
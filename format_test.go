@@ -0,0 +1,229 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+const formatTestPackage = `package foo
+
+// Foo does things. It has options:
+//   - one
+//   - two
+//
+// # Usage
+//
+// Call it:
+//
+//	Foo()
+func Foo() {}
+`
+
+const formatTestExample = `package foo
+
+func ExampleFoo() {
+	Foo()
+	// Output:
+}
+`
+
+func TestAsciiDoc(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go":      formatTestPackage,
+		"foo_test.go": formatTestExample,
+	})
+	m.Format = AsciiDoc
+	m.RenderMarkdown = true
+	tests := map[string]func() (string, error){
+		"[source,go]\n----\nFoo()\n// Output:\n----":                                                     func() (string, error) { return m.Example("ExampleFoo", false) },
+		"[source,go]\n----\nfunc Foo()\n----":                                                            func() (string, error) { return m.Signature("Foo") },
+		"Foo does things. It has options:\n\n* one\n* two\n\n=== Usage\n\nCall it:\n\n----\nFoo()\n----": func() (string, error) { return m.Doc("Foo") },
+		"Call it:\n\n----\nFoo()\n----":                                                                  func() (string, error) { return m.Doc("Foo[-2:]") },
+	}
+	for expected, f := range tests {
+		found, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{
+		"":         Markdown,
+		"markdown": Markdown,
+		"AsciiDoc": AsciiDoc,
+	}
+	for name, expected := range tests {
+		found, err := ParseFormat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %d. Found %d.", name, expected, found)
+		}
+	}
+	if _, err := ParseFormat("troff"); err == nil {
+		t.Fatal("Expected error for unknown format.")
+	}
+}
+
+func TestRST(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": formatTestPackage,
+		"foo_test.go": `package foo_test
+
+import "example.com/foo"
+
+func ExampleFoo() {
+	if true {
+		foo.Foo()
+	}
+
+	// Output:
+}
+`,
+	})
+	m.Format = RST
+	m.RenderMarkdown = true
+	tests := map[string]func() (string, error){
+		".. code-block:: go\n\n   if true {\n   \tfoo.Foo()\n   }\n\n   // Output:": func() (string, error) { return m.Example("ExampleFoo", false) },
+		".. code-block:: go\n\n   package main\n\n   import (\n   \t\"example.com/foo\"\n   )\n\n   func main() {\n   \tif true {\n   \t\tfoo.Foo()\n   \t}\n   }": func() (string, error) {
+			return m.Playground("ExampleFoo")
+		},
+		"Foo does things. It has options:\n\n- one\n- two\n\nUsage\n-----\n\nCall it:\n\n::\n\n   Foo()": func() (string, error) { return m.Doc("Foo") },
+	}
+	for expected, f := range tests {
+		found, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo sends a <- b & returns. See https://example.com/foo.
+//
+// Options:
+//  1. one
+//  2. T[int]
+//
+// Usage:
+//
+//	a <- b
+func Foo() {}
+
+// Bar is a generic.
+func Bar[T any](t T) {}
+`,
+		"foo_test.go": `package foo
+
+func ExampleFoo() {
+	a, b := make(chan int), 1
+	a <- b
+	Bar[int](b)
+}
+`,
+	})
+	m.Format = HTML
+	m.RenderMarkdown = true
+	m.Linkify = true
+	tests := map[string]func() (string, error){
+		"<pre><code class=\"language-go\">a, b := make(chan int), 1\na &lt;- b\nBar[int](b)</code></pre>": func() (string, error) { return m.Example("ExampleFoo", false) },
+		"<pre><code class=\"language-go\">func Bar[T any](t T)</code></pre>":                              func() (string, error) { return m.Signature("Bar") },
+		"<p>Foo sends a &lt;- b &amp; returns. See <a href=\"https://example.com/foo\">https://example.com/foo</a>.</p>\n\n<p>Options:</p>\n\n<ol>\n<li>one</li>\n<li>T[int]</li>\n</ol>\n\n<p>Usage:</p>\n\n<pre><code>a &lt;- b</code></pre>": func() (string, error) {
+			return m.Doc("Foo")
+		},
+		"Foo sends a &lt;- b &amp; returns.": func() (string, error) { return m.Doc("Foo[0]") },
+		"Foo sends a &lt;- b &amp;":          func() (string, error) { return m.Doc("Foo{0:6}") },
+	}
+	for expected, f := range tests {
+		found, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo
+
+func ExampleFoo() {
+	a := 1
+	b := 2
+	c := a + b
+	_ = c
+}
+`,
+	})
+	tests := []struct {
+		format    Format
+		highlight string
+		expected  string
+	}{
+		{Markdown, "lines=2", "```go {2}\na := 1\nb := 2\nc := a + b\n_ = c\n```"},
+		{Markdown, "1,3-9,12", "```go {1,3-4}\na := 1\nb := 2\nc := a + b\n_ = c\n```"},
+		{Markdown, "lines=7", "```go\na := 1\nb := 2\nc := a + b\n_ = c\n```"},
+		{Markdown, "lines=0", "```go\na := 1\nb := 2\nc := a + b\n_ = c\n```"},
+		{Markdown, "lines=0-2,4", "```go {1-2,4}\na := 1\nb := 2\nc := a + b\n_ = c\n```"},
+		{AsciiDoc, "lines=1,3-4", "[source,go,highlight=1;3..4]\n----\na := 1\nb := 2\nc := a + b\n_ = c\n----"},
+		{RST, "lines=2-3", ".. code-block:: go\n   :emphasize-lines: 2-3\n\n   a := 1\n   b := 2\n   c := a + b\n   _ = c"},
+		{HTML, "lines=1", "<pre data-line=\"1\"><code class=\"language-go\">a := 1\nb := 2\nc := a + b\n_ = c</code></pre>"},
+	}
+	for _, test := range tests {
+		m.Format = test.format
+		found, err := m.Example("ExampleFoo", false, test.highlight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Fatalf("Highlight: %s. Expected %s. Found %s.", test.highlight, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	m.Format = Markdown
+	for _, spec := range []string{"lines=x", "lines=3-1", "lines=-1", "lines=1-"} {
+		if _, err := m.Example("ExampleFoo", false, spec); err == nil {
+			t.Fatalf("Highlight: %s. Expected error.", spec)
+		}
+	}
+}
+
+func TestIndent(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\n// Foo does things.\n//\n// It has options.\nfunc Foo() {}\n",
+	})
+	tests := []struct {
+		prefix, text, expected string
+	}{
+		{"> ", "one\ntwo\n\nthree", "> one\n> two\n>\n> three"},
+		{"> ", "one\ntwo\n", "> one\n> two\n"},
+		{"  ", "- one\n\n- two", "  - one\n\n  - two"},
+		{"> ", "", ""},
+	}
+	for _, test := range tests {
+		if found := m.IndentFunc(test.prefix, test.text); found != test.expected {
+			t.Fatalf("Text: %s. Expected %s. Found %s.", strconv.Quote(test.text), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	found, err := RenderString(`{{ doc "Foo" | indent "> " }}`, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "> Foo does things.\n>\n> It has options."; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
@@ -0,0 +1,179 @@
+package rebecca
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ModulePathFunc returns the module path from the nearest go.mod, found by
+// walking up from the package directory. This is the real import path, which
+// the package given to NewCodeMap may not be. If it can't be found, the error
+// is recorded in m.Errors and an empty string is returned.
+func (m *CodeMap) ModulePathFunc() string {
+	out, err := m.ModulePath()
+	if err != nil {
+		m.recordError(err)
+	}
+	return out
+}
+
+// ModulePath returns the module path from the nearest go.mod. See
+// ModulePathFunc.
+func (m *CodeMap) ModulePath() (string, error) {
+	module, _, err := m.goMod()
+	return module, err
+}
+
+// GoVersionFunc returns the go directive from the nearest go.mod, e.g. "1.19",
+// the minimum Go version of the module. If it can't be found, the error is
+// recorded in m.Errors and an empty string is returned.
+func (m *CodeMap) GoVersionFunc() string {
+	out, err := m.GoVersion()
+	if err != nil {
+		m.recordError(err)
+	}
+	return out
+}
+
+// GoVersion returns the go directive from the nearest go.mod. See
+// GoVersionFunc.
+func (m *CodeMap) GoVersion() (string, error) {
+	_, version, err := m.goMod()
+	if err == nil && version == "" {
+		err = fmt.Errorf("no go directive in go.mod for %s", m.pkg)
+	}
+	return version, err
+}
+
+// ImportPath returns the import path of the package in dir, from the module
+// path in the nearest go.mod and the path of dir below it, e.g.
+// example.com/foo/client for the client directory of module example.com/foo.
+// It works for modules outside GOPATH.
+func ImportPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name, data, err := findGoMod(dir)
+	if err != nil {
+		return "", err
+	}
+	module, _, err := parseGoMod(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(name), dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return module, nil
+	}
+	return path.Join(module, filepath.ToSlash(rel)), nil
+}
+
+// recordError adds err to m.Errors.
+func (m *CodeMap) recordError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Errors = append(m.Errors, err)
+}
+
+// goMod finds the nearest go.mod and returns its module path and go
+// directive. Packages scanned from disk are searched up to the root of the
+// file system, and those in an fs.FS up to the root of the FS.
+func (m *CodeMap) goMod() (module, version string, err error) {
+	var name string
+	var data []byte
+	if m.cache {
+		name, data, err = findGoMod(m.dir)
+	} else {
+		name, data, err = findGoModFS(m.fsys, m.root)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	module, version, err = parseGoMod(data)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", name, err)
+	}
+	return module, version, nil
+}
+
+// findGoMod returns the name and contents of the first go.mod in dir or its
+// parents.
+func findGoMod(dir string) (string, []byte, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		name := filepath.Join(dir, "go.mod")
+		data, err := os.ReadFile(name)
+		if err == nil {
+			return name, data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, fmt.Errorf("no go.mod found for %s", dir)
+		}
+		dir = parent
+	}
+}
+
+// findGoModFS is findGoMod for a directory in fsys.
+func findGoModFS(fsys fs.FS, dir string) (string, []byte, error) {
+	start := dir
+	for {
+		name := path.Join(dir, "go.mod")
+		data, err := fs.ReadFile(fsys, name)
+		if err == nil {
+			return name, data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+		if dir == "." {
+			return "", nil, fmt.Errorf("no go.mod found for %s", start)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// parseGoMod returns the module path and go directive in the go.mod file
+// data. Only these two directives are read.
+func parseGoMod(data []byte) (module, version string, err error) {
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			module = fields[1]
+			if strings.HasPrefix(module, `"`) || strings.HasPrefix(module, "`") {
+				if module, err = strconv.Unquote(module); err != nil {
+					return "", "", fmt.Errorf("line %d: invalid module path %s", i+1, fields[1])
+				}
+			}
+		case "go":
+			version = fields[1]
+		}
+	}
+	if module == "" {
+		return "", "", errors.New("no module directive")
+	}
+	return module, version, nil
+}
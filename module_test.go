@@ -0,0 +1,72 @@
+package rebecca
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestModule(t *testing.T) {
+	dir := t.TempDir()
+	gomod := "// comment\nmodule \"example.com/real\" // the real path\n\ngo 1.21\n\nrequire example.com/other v1.0.0\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "sub.go"), []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewCodeMap("./sub", sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := m.ModulePathFunc(); found != "example.com/real" {
+		t.Fatalf("Expected module path example.com/real. Found %s.", found)
+	}
+	if found := m.GoVersionFunc(); found != "1.21" {
+		t.Fatalf("Expected go version 1.21. Found %s.", found)
+	}
+
+	for d, expected := range map[string]string{dir: "example.com/real", sub: "example.com/real/sub"} {
+		found, err := ImportPath(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Dir: %s. Expected %s. Found %s.", d, expected, found)
+		}
+	}
+	if _, err := ImportPath(filepath.Dir(dir)); err == nil {
+		t.Fatal("Expected error for a directory without a go.mod.")
+	}
+
+	fsys := fstest.MapFS{
+		"go.mod":         {Data: []byte("module example.com/fs\n")},
+		"a/b/b.go":       {Data: []byte("package b\n")},
+		"other/other.go": {Data: []byte("package other\n")},
+	}
+	m, err = NewCodeMapFS("example.com/fs/a/b", fsys, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := m.ModulePathFunc(); found != "example.com/fs" {
+		t.Fatalf("Expected module path example.com/fs. Found %s.", found)
+	}
+	if found := m.GoVersionFunc(); found != "" || len(m.Errors) != 1 || !strings.Contains(m.Errors[0].Error(), "no go directive") {
+		t.Fatalf("Expected no go version and an error. Found %s and %v.", found, m.Errors)
+	}
+
+	delete(fsys, "go.mod")
+	m, err = NewCodeMapFS("example.com/fs/other", fsys, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := m.ModulePathFunc(); found != "" || len(m.Errors) != 1 || !strings.Contains(m.Errors[0].Error(), "no go.mod found") {
+		t.Fatalf("Expected no module path and an error. Found %s and %v.", found, m.Errors)
+	}
+}
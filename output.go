@@ -0,0 +1,76 @@
+package rebecca
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OutputTableFunc returns the expected output of the named example as a
+// table, e.g. for an example printing a before and after column. Each line is
+// split on m.OutputDelimiter, a tab by default, and the first line is the
+// header. It panics if the example is not found or a line has more cells than
+// the header.
+func (m *CodeMap) OutputTableFunc(in string) string {
+	out, err := m.OutputTable(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// OutputTable returns the expected output of the named example as a table.
+// See OutputTableFunc. Blank lines are skipped and missing cells are empty.
+func (m *CodeMap) OutputTable(in string) (string, error) {
+	out, err := m.Output(in)
+	if err != nil {
+		return "", err
+	}
+	delim := m.OutputDelimiter
+	if delim == "" {
+		delim = "\t"
+	}
+	var header []string
+	var rows [][]string
+	for i, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		cells := strings.Split(line, delim)
+		for j, cell := range cells {
+			cells[j] = strings.TrimSpace(cell)
+		}
+		if header == nil {
+			header = cells
+			continue
+		}
+		if len(cells) > len(header) {
+			return "", fmt.Errorf("line %d of the output of %s has %d cells, but the header has %d", i+1, in, len(cells), len(header))
+		}
+		rows = append(rows, append(cells, make([]string, len(header)-len(cells))...))
+	}
+	if header == nil {
+		return "", fmt.Errorf("example %s has no output", in)
+	}
+	return m.table(header, rows), nil
+}
+
+// OutputDiffFunc returns the expected output of the named example in a diff
+// code block, so lines starting with "+" and "-" are highlighted. It panics if
+// the example is not found.
+func (m *CodeMap) OutputDiffFunc(in string) string {
+	out, err := m.OutputDiff(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// OutputDiff returns the expected output of the named example in a diff code
+// block. See OutputDiffFunc.
+func (m *CodeMap) OutputDiff(in string) (string, error) {
+	out, err := m.Output(in)
+	if err != nil {
+		return "", err
+	}
+	return m.fenceLang(out, "diff", nil), nil
+}
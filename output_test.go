@@ -0,0 +1,111 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestOutputTable(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+`,
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleTable() {
+	fmt.Println("Before\tAfter")
+	fmt.Println("foo_bar\tFooBar")
+	fmt.Println("a|b")
+	// Output:
+	// Before	After
+	// foo_bar	FooBar
+	// a|b
+}
+
+func ExampleDiff() {
+	fmt.Println("-old")
+	fmt.Println("+new")
+	// Output:
+	// -old
+	// +new
+}
+
+func ExampleWide() {
+	fmt.Println("A")
+	fmt.Println("b\tc")
+	// Output:
+	// A
+	// b	c
+}
+`,
+	})
+	expected := "| Before | After |\n| --- | --- |\n| foo_bar | FooBar |\n| a\\|b |  |"
+	if found := m.OutputTableFunc("ExampleTable"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+
+	m.OutputDelimiter = "|"
+	if _, err := m.OutputTable("ExampleTable"); err == nil {
+		t.Fatal("Expected error for a line with more cells than the header.")
+	}
+	expected = "| -old |\n| --- |\n| +new |"
+	if found := m.OutputTableFunc("ExampleDiff"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	m.OutputDelimiter = ""
+
+	if _, err := m.OutputTable("ExampleWide"); err == nil {
+		t.Fatal("Expected error for a line with more cells than the header.")
+	}
+
+	expected = "```diff\n-old\n+new\n```"
+	if found := m.OutputDiffFunc("ExampleDiff"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.OutputDiff("ExampleMissing"); err == nil {
+		t.Fatal("Expected error for missing example.")
+	}
+}
+
+func TestOutputLabel(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+`,
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleFoo() {
+	fmt.Println("result: 1")
+	fmt.Println("stderr: warning")
+	fmt.Println("result:  2")
+	fmt.Println("done")
+	// Output:
+	// result: 1
+	// stderr: warning
+	// result:  2
+	// done
+}
+`,
+	})
+	tests := map[string]string{
+		"result:": "1\n2",
+		"stderr:": "warning",
+		"done":    "",
+	}
+	for label, expected := range tests {
+		if found := m.OutputFunc("ExampleFoo", label); found != expected {
+			t.Fatalf("Label: %s. Expected %s. Found %s.", label, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	expected := "result: 1\nstderr: warning\nresult:  2\ndone"
+	if found := m.OutputFunc("ExampleFoo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	for _, label := range [][]string{{"stdout:"}, {""}, {"result:", "stderr:"}} {
+		if _, err := m.Output("ExampleFoo", label...); err == nil {
+			t.Fatalf("Label: %q. Expected error.", label)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package rebecca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// parseTestFS returns a package of n files, including examples and a file
+// that doesn't parse.
+func parseTestFS(n int) fstest.MapFS {
+	fsys := fstest.MapFS{
+		"foo/broken.go": {Data: []byte("package foo\n\nfunc {\n")},
+	}
+	for i := 0; i < n; i++ {
+		fsys[fmt.Sprintf("foo/f%d.go", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(
+			"package foo\n\n// F%d does things. It has a doc.\nfunc F%d(a, b int) int {\n\treturn a + b\n}\n", i, i))}
+		fsys[fmt.Sprintf("foo/f%d_test.go", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(
+			"package foo\n\nimport \"fmt\"\n\nfunc ExampleF%d() {\n\tfmt.Println(F%d(1, 2))\n\t// Output: 3\n}\n", i, i))}
+	}
+	return fsys
+}
+
+func TestParallelParse(t *testing.T) {
+	fsys := parseTestFS(50)
+	sequential, err := NewCodeMapFS("example.com/foo", fsys, "foo", WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := NewCodeMapFS("example.com/foo", fsys, "foo", WithWorkers(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sequential.Comments, parallel.Comments) {
+		t.Fatal("Expected the same comments.")
+	}
+	for name := range sequential.Decls {
+		if _, ok := parallel.Decls[name]; !ok {
+			t.Fatalf("Expected decl %s.", name)
+		}
+	}
+	for name := range sequential.Examples {
+		s, err := sequential.Example(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := parallel.Example(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != p {
+			t.Fatalf("Example: %s. Expected %s. Found %s.", name, s, p)
+		}
+	}
+	if len(sequential.Decls) != len(parallel.Decls) || len(sequential.Examples) != len(parallel.Examples) {
+		t.Fatal("Expected the same number of decls and examples.")
+	}
+	if fmt.Sprint(sequential.Errors) != fmt.Sprint(parallel.Errors) {
+		t.Fatalf("Expected errors %v. Found %v.", sequential.Errors, parallel.Errors)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	dir := b.TempDir()
+	for name, f := range parseTestFS(100) {
+		path := filepath.Join(dir, filepath.Base(name))
+		if err := os.WriteFile(path, f.Data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// NewCodeMapFS doesn't use the cache
+				if _, err := NewCodeMapFS("example.com/foo", os.DirFS(dir), ".", WithWorkers(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package rebecca
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PlaintextFunc returns the documentation for the named declaration as a
+// single line of prose, e.g. for a description in package metadata. Code
+// blocks are dropped, links are replaced by their text and whitespace is
+// collapsed. Sentances, words and paragraphs can be selected as in DocFunc. It
+// panics if the declaration is not found.
+func (m *CodeMap) PlaintextFunc(in string) string {
+	out, err := m.Plaintext(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Plaintext returns the documentation for the named declaration as plain
+// text. See PlaintextFunc.
+func (m *CodeMap) Plaintext(in string) (string, error) {
+	out, err := m.extractDoc(in, docRenderer{format: Markdown})
+	if err != nil {
+		return "", err
+	}
+	// a selected sentance may use a link defined elsewhere in the doc
+	id := in
+	for _, r := range []*regexp.Regexp{wordRegex, docRegex, paragraphRegex} {
+		if matches := r.FindStringSubmatch(in); matches != nil {
+			id = matches[1]
+		}
+	}
+	c, _ := m.comment(id)
+	return plaintext(out, linkDefs(c)), nil
+}
+
+var (
+	fencedRegex   = regexp.MustCompile("(?s)```\n.*?\n```")
+	linkDefRegex  = regexp.MustCompile(`(?m)^\[([^\]\n]+)\]:\s+\S+$`)
+	mdLinkRegex   = regexp.MustCompile(`\[([^\]\n]+)\]\([^)\s]+\)`)
+	linkRefRegex  = regexp.MustCompile(`\[([^\]\n]+)\]`)
+	autoLinkRegex = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	backtickRegex = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// plaintext flattens doc text rendered as markdown to a single line, see
+// PlaintextFunc. Links to the link definitions in defs are replaced by their
+// text.
+func plaintext(s string, defs map[string]bool) string {
+	s = fencedRegex.ReplaceAllString(s, "")
+	s = linkDefRegex.ReplaceAllString(s, "")
+	s = mdLinkRegex.ReplaceAllString(s, "$1")
+	s = unwrapDocLinks(s, defs)
+	s = autoLinkRegex.ReplaceAllString(s, "$1")
+	s = backtickRegex.ReplaceAllString(s, "$1")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// linkDefs returns the names of the link definitions in doc, e.g. "the spec"
+// for "[the spec]: https://example.com/spec".
+func linkDefs(doc string) map[string]bool {
+	defs := map[string]bool{}
+	for _, def := range linkDefRegex.FindAllStringSubmatch(doc, -1) {
+		defs[def[1]] = true
+	}
+	return defs
+}
+
+// unwrapDocLinks replaces the doc links in s, e.g. [Conn.Close], and links to
+// the link definitions in defs, e.g. [the spec], by their text. Other brackets,
+// e.g. in s[i], are kept.
+func unwrapDocLinks(s string, defs map[string]bool) string {
+	var out string
+	var last int
+	for _, span := range docLinkSpans(s) {
+		target := strings.TrimPrefix(s[span[2]:span[3]], "*")
+		if !localDocLinkRegex.MatchString(target) && importDocLinkURL("", target) == "" {
+			continue
+		}
+		out += s[last:span[0]] + s[span[2]:span[3]]
+		last = span[1]
+	}
+	s = out + s[last:]
+	return linkRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if text := ref[1 : len(ref)-1]; defs[text] {
+			return text
+		}
+		return ref
+	})
+}
@@ -0,0 +1,44 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlaintext(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things, see https://example.com/foo and
+// [the spec] or [Bar].
+//
+//	foo := Foo()
+//	foo.Run()
+//
+// Use the ` + "`-v`" + ` flag for   more.
+//
+// [the spec]: https://example.com/spec
+func Foo() {}
+
+func Bar() {}
+
+// Baz returns s[i] and a[0], or [1] of [*Bar] and [io.Reader].
+func Baz() {}
+`,
+	})
+	m.RenderMarkdown = true
+	m.Linkify = true
+	tests := map[string]string{
+		"Foo":     "Foo does things, see https://example.com/foo and the spec or Bar. Use the -v flag for more.",
+		"Baz":     "Baz returns s[i] and a[0], or [1] of *Bar and io.Reader.",
+		"Foo[0]":  "Foo does things, see https://example.com/foo and the spec or Bar.",
+		"Foo[1]":  "",
+		"Foo¶[2]": "Use the -v flag for more.",
+	}
+	for in, expected := range tests {
+		found := m.PlaintextFunc(in)
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package rebecca
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultPlaygroundShareURL is the endpoint used to share playground programs
+// when CodeMap.PlaygroundShareURL is empty.
+const DefaultPlaygroundShareURL = "https://go.dev/_/share"
+
+// playgroundLinkBase is prefixed to the id returned by the share endpoint.
+const playgroundLinkBase = "https://go.dev/play/p/"
+
+// PlaygroundLinkFunc uploads the named example to the Go Playground and
+// returns the URL of the shared program. It panics if the example is not
+// found or can't be shared.
+func (m *CodeMap) PlaygroundLinkFunc(in string) string {
+	out, err := m.PlaygroundLink(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// PlaygroundLink uploads the named example to the Go Playground. See
+// PlaygroundLinkFunc. Links are cached, so identical code is normally only
+// uploaded once.
+func (m *CodeMap) PlaygroundLink(in string) (string, error) {
+	src, err := m.playSource(in)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.RLock()
+	link, ok := m.links[src]
+	m.mu.RUnlock()
+	if ok {
+		return link, nil
+	}
+
+	shareURL := m.PlaygroundShareURL
+	if shareURL == "" {
+		shareURL = DefaultPlaygroundShareURL
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(shareURL, "text/plain; charset=utf-8", strings.NewReader(src))
+	if err != nil {
+		return "", fmt.Errorf("failed to share %s: %v", in, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to share %s: %v", in, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to share %s: %s: %s", in, resp.Status, strings.TrimSpace(string(body)))
+	}
+	id := strings.TrimSpace(string(body))
+	if id == "" {
+		return "", fmt.Errorf("failed to share %s: empty response", in)
+	}
+
+	link = playgroundLinkBase + id
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.links == nil {
+		m.links = map[string]string{}
+	}
+	m.links[src] = link
+	return link, nil
+}
@@ -0,0 +1,52 @@
+package rebecca
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPlaygroundLink(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go":      {Data: []byte("package foo\n\n// Foo does things.\nfunc Foo() {}\n")},
+		"foo_test.go": {Data: []byte("package foo_test\n\nimport \"fmt\"\n\nfunc ExampleFoo() {\n\tfmt.Println(\"a\")\n\t// Output: a\n}\n")},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || len(body) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "abc123")
+	}))
+	defer server.Close()
+	m.PlaygroundShareURL = server.URL
+
+	for i := 0; i < 2; i++ {
+		link, err := m.PlaygroundLink("ExampleFoo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != "https://go.dev/play/p/abc123" {
+			t.Fatalf("Expected playground link. Found %s.", link)
+		}
+	}
+	if uploads != 1 {
+		t.Fatalf("Expected 1 upload. Found %d.", uploads)
+	}
+
+	server.Close()
+	m.links = nil
+	if _, err := m.PlaygroundLink("ExampleFoo"); err == nil {
+		t.Fatal("Expected error when the share endpoint is down.")
+	}
+}
@@ -3,137 +3,1790 @@ package rebecca
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/doc"
 	"go/format"
-	"go/parser"
 	"go/printer"
 	"go/token"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-func NewCodeMap(pkg string, dir string) (*CodeMap, error) {
+// Option configures a CodeMap. Options are applied before the package is
+// scanned.
+type Option func(*CodeMap)
+
+// WithFileFilter only scans the files for which filter returns true, e.g. to
+// skip generated files or mocks.
+func WithFileFilter(filter func(fs.FileInfo) bool) Option {
+	return func(m *CodeMap) {
+		m.filter = filter
+	}
+}
+
+// WithWorkers sets the number of files parsed concurrently. Defaults to
+// runtime.GOMAXPROCS(0).
+func WithWorkers(n int) Option {
+	return func(m *CodeMap) {
+		m.workers = n
+	}
+}
+
+// WithExportedOnly skips unexported declarations when scanning, so they can't
+// be used by the template. See CodeMap.ExportedOnly.
+func WithExportedOnly() Option {
+	return func(m *CodeMap) {
+		m.ExportedOnly = true
+	}
+}
+
+// WithNoteMarkers recognises notes with the given markers that have no uid,
+// e.g. "PERF: ..." for "PERF". Notes with a uid, e.g. "SECURITY(team): ...",
+// are recognised for any marker, as in go/doc.
+func WithNoteMarkers(markers ...string) Option {
+	return func(m *CodeMap) {
+		m.noteMarkers = append(m.noteMarkers, markers...)
+	}
+}
+
+// WithPlatform only scans the files built for goos and goarch, following the
+// file name suffixes and //go:build constraints. See CodeMap.GOOS.
+func WithPlatform(goos, goarch string) Option {
+	return func(m *CodeMap) {
+		m.GOOS, m.GOARCH = goos, goarch
+	}
+}
+
+// WithExampleDocs adds the doc comments of the example functions to Comments,
+// keyed by "Example." and the name of the example with dots, e.g.
+// "Example.Conn.Close" for ExampleConn_Close, so they can be printed by
+// DocFunc.
+func WithExampleDocs() Option {
+	return func(m *CodeMap) {
+		m.exampleDocs = true
+	}
+}
+
+// WithFuncs adds funcs to the template functions used by Render, for Process
+// and Check. See CodeMap.Funcs.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(m *CodeMap) {
+		if m.Funcs == nil {
+			m.Funcs = template.FuncMap{}
+		}
+		for name, fn := range funcs {
+			m.Funcs[name] = fn
+		}
+	}
+}
+
+// WithExampleInclude only scans the examples whose function names match one
+// of the patterns, using the syntax of path.Match, e.g. "ExampleConn*".
+func WithExampleInclude(patterns ...string) Option {
+	return func(m *CodeMap) {
+		m.exampleInclude = append(m.exampleInclude, patterns...)
+	}
+}
+
+// WithExampleExclude skips the examples whose function names match one of the
+// patterns, using the syntax of path.Match, e.g. "Example_internal*".
+func WithExampleExclude(patterns ...string) Option {
+	return func(m *CodeMap) {
+		m.exampleExclude = append(m.exampleExclude, patterns...)
+	}
+}
+
+// NewCodeMap scans the package in dir. Parsed files are cached, so scanning an
+// unchanged directory again is fast. See ClearCache.
+func NewCodeMap(pkg string, dir string, options ...Option) (*CodeMap, error) {
+	m := newCodeMap(pkg, os.DirFS(dir), ".", dir, options)
+	m.fset = cacheFileSet()
+	m.cache = true
+	if err := m.scanDir(); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("no Go packages found in %s", dir)
+	}
+	return m, nil
+}
+
+// NewCodeMapFS scans the package in dir in fsys, e.g. embedded sources or an
+// fstest.MapFS.
+func NewCodeMapFS(pkg string, fsys fs.FS, dir string, options ...Option) (*CodeMap, error) {
+	m := newCodeMap(pkg, fsys, dir, dir, options)
+	if err := m.scanDir(); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("no Go packages found in %s", dir)
+	}
+	return m, nil
+}
+
+// newCodeMap returns an empty CodeMap that reads the package in root in fsys.
+// File names are reported relative to dir.
+func newCodeMap(pkg string, fsys fs.FS, root string, dir string, options []Option) *CodeMap {
 	m := &CodeMap{
 		pkg:      pkg,
 		dir:      dir,
+		fsys:     fsys,
+		root:     root,
 		Examples: map[string]*doc.Example{},
 		Comments: map[string]string{},
+		Decls:    map[string]ast.Node{},
+		Notes:    map[string][]*doc.Note{},
+		Snippets: map[string]string{},
+		Packages: map[string]*CodeMap{},
 	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// NewRecursiveCodeMap scans the package in rootDir and every package in its
+// subdirectories. Entries in subpackages are qualified by the path of the
+// subpackage relative to rootDir, e.g. "client.Connect" or
+// "internal/db.Conn.Close". Unqualified names refer to the root package.
+// Directories named testdata, or starting with "." or "_" are skipped. The
+// root directory needn't have any Go files if a subdirectory does.
+func NewRecursiveCodeMap(rootPkg string, rootDir string, options ...Option) (*CodeMap, error) {
+	m := newCodeMap(rootPkg, os.DirFS(rootDir), ".", rootDir, options)
+	m.fset = cacheFileSet()
+	m.cache = true
 	if err := m.scanDir(); err != nil {
 		return nil, err
 	}
+	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == rootDir {
+			return nil
+		}
+		if name := d.Name(); name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sub := newCodeMap(rootPkg+"/"+rel, os.DirFS(path), ".", path, options)
+		sub.fset = m.fset
+		sub.cache = true
+		if err := sub.scanDir(); err != nil {
+			return err
+		}
+		m.Errors = append(m.Errors, sub.Errors...)
+		if sub.Name == "" {
+			// no Go files
+			return nil
+		}
+		m.Packages[rel] = sub
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m.Name == "" && len(m.Packages) == 0 {
+		return nil, fmt.Errorf("no Go packages found in %s", rootDir)
+	}
 	return m, nil
 }
 
+// CodeMap holds the examples and documentation of a package.
+//
+// Once created, a CodeMap is safe for concurrent use: its helpers may be
+// called from several goroutines, e.g. to execute templates in parallel. The
+// maps and the exported fields must not be modified while they are in use.
 type CodeMap struct {
 	pkg      string
 	dir      string
+	fsys     fs.FS
+	root     string
+	filter   func(fs.FileInfo) bool
 	Name     string
 	fset     *token.FileSet
+	cache    bool
+	workers  int
+	files    []*ast.File
 	Examples map[string]*doc.Example
 	Comments map[string]string
+	// Decls holds the declarations in the package, keyed by the same names as
+	// Comments.
+	Decls map[string]ast.Node
+	// Errors holds the problems found while scanning, e.g. files that were
+	// skipped because they couldn't be parsed.
+	Errors []error
+	// Notes holds the marker notes (e.g. "BUG(who): ...") in the package,
+	// keyed by marker.
+	Notes map[string][]*doc.Note
+	// Snippets holds the source between "// rebecca:snippet name" and
+	// "// rebecca:end" comments, keyed by name.
+	Snippets map[string]string
+	// Packages holds the subpackages scanned by NewRecursiveCodeMap, keyed by
+	// their path relative to the root package.
+	Packages map[string]*CodeMap
+
+	// GOOS and GOARCH are the platform the package is scanned for: files
+	// excluded by their name (e.g. server_windows.go) or build constraints
+	// are skipped. Default to the host. They are set before scanning with
+	// WithPlatform.
+	GOOS, GOARCH string
+
+	// ExportedOnly skips unexported functions, methods, types, consts and
+	// vars, and the methods of unexported types, when scanning. It is set
+	// before scanning with WithExportedOnly.
+	ExportedOnly bool
+
+	// Linkify wraps bare URLs in the output of DocFunc as markdown autolinks.
+	// URLs in code blocks are left alone.
+	Linkify bool
+
+	// RenderMarkdown converts godoc headings, lists and doc links, e.g.
+	// [Conn.Close], in the output of DocFunc to markdown. By default they are
+	// printed verbatim.
+	RenderMarkdown bool
+
+	// PlaygroundShareURL is the endpoint used by PlaygroundLinkFunc to share
+	// examples. Defaults to DefaultPlaygroundShareURL.
+	PlaygroundShareURL string
+
+	// GodocURL is the base URL used by LinkFunc. Defaults to DefaultGodocURL.
+	GodocURL string
+
+	// CoverageImageURL and CoverageLinkURL are the image and link of the
+	// coverage badge printed by BadgeFunc. Default to coveralls.io.
+	CoverageImageURL, CoverageLinkURL string
+
+	// SourceURL is the URL of the repository used by SourceLinkFunc, e.g.
+	// "https://github.com/dave/rebecca". SourceRef is the branch, tag or
+	// commit. Default to the github.com repository of the package and
+	// DefaultSourceRef.
+	SourceURL, SourceRef string
+
+	// StripDeprecated removes the "Deprecated: ..." paragraph from the output
+	// of DocFunc, e.g. to print it separately with DeprecatedFunc.
+	StripDeprecated bool
+
+	// StripIdentPrefix removes the name of the declaration from the start of
+	// the output of DocFunc, e.g. for use under a heading that already names
+	// it. This is done before sentances are selected.
+	StripIdentPrefix bool
+
+	// Format is the markup used for code blocks and, with RenderMarkdown,
+	// headings and lists. Defaults to Markdown.
+	Format Format
+
+	// FenceLang is the info string of the code blocks printed by ExampleFunc,
+	// SignatureFunc, DeclFunc and BodyFunc. Defaults to "go". Code blocks in
+	// docs only have an info string if it is set, because they may not be Go.
+	FenceLang string
+
+	// FenceChar is the character repeated to make code fences, either '`' or
+	// '~', including those of code blocks in docs. Defaults to '`'.
+	FenceChar rune
+
+	// OutputDelimiter separates the cells in each line of output printed by
+	// OutputTableFunc. Defaults to a tab.
+	OutputDelimiter string
+
+	// AllowRun allows HelpFunc to build and run the command in the package
+	// directory. RunTimeout limits the time taken, and defaults to
+	// DefaultRunTimeout.
+	AllowRun   bool
+	RunTimeout time.Duration
+
+	// LeftDelim and RightDelim are the action delimiters used by Render, e.g.
+	// to avoid clashing with "{{" in code samples. Default to "{{" and "}}".
+	LeftDelim, RightDelim string
+
+	// HTMLTemplate makes Render use html/template rather than text/template,
+	// so that text printed by the template is escaped. It requires Format
+	// HTML. The helpers that print HTML return template.HTML, so their
+	// already escaped code and documentation isn't escaped again.
+	HTMLTemplate bool
+
+	// Funcs are extra template functions for Render, e.g. project specific
+	// helpers. They replace the built-in functions with the same name.
+	Funcs template.FuncMap
+
+	// exampleDocs and noteMarkers are set by WithExampleDocs and
+	// WithNoteMarkers, and exampleInclude and exampleExclude by
+	// WithExampleInclude and WithExampleExclude.
+	exampleDocs                    bool
+	noteMarkers                    []string
+	exampleInclude, exampleExclude []string
+
+	// packageDoc is the package comment, see PackageDocFunc.
+	packageDoc string
+
+	// mu guards the state computed lazily by the helpers.
+	mu      sync.RWMutex
+	links   map[string]string     // cache of playground links, keyed by source
+	printed map[exampleKey]string // cache of printed examples
+}
+
+// lookup resolves a name that may be qualified with the path of a subpackage
+// (see NewRecursiveCodeMap), returning the CodeMap for the package and the
+// unqualified name. Names with no qualifier resolve to m.
+func (m *CodeMap) lookup(in string) (*CodeMap, string) {
+	var found string
+	for path := range m.Packages {
+		if strings.HasPrefix(in, path+".") && len(path) > len(found) {
+			found = path
+		}
+	}
+	if found == "" {
+		return m, in
+	}
+	return m.Packages[found], strings.TrimPrefix(in, found+".")
+}
+
+// has reports whether name is documented, declared or an example in m.
+func (m *CodeMap) has(name string) bool {
+	_, documented := m.Comments[name]
+	_, declared := m.Decls[name]
+	_, example := m.Examples[name]
+	return documented || declared || example
+}
+
+// candidates returns the sorted paths of the subpackages that have name.
+func (m *CodeMap) candidates(name string) []string {
+	var paths []string
+	for path, p := range m.Packages {
+		if p.has(name) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// notFound returns err, or if in is an unqualified name that isn't in the
+// root package but is in more than one subpackage, an error listing the
+// qualified names. If in isn't found at all, the most similar name is
+// suggested, to help fix typos in templates.
+func (m *CodeMap) notFound(in string, err error) error {
+	p, name := m.lookup(in)
+	if p.has(name) {
+		return err
+	}
+	if paths := m.candidates(in); p == m && len(paths) > 1 {
+		for i, path := range paths {
+			paths[i] = path + "." + in
+		}
+		return fmt.Errorf("%s is ambiguous, use one of %s", in, strings.Join(paths, ", "))
+	}
+	if similar := p.similar(name); similar != "" {
+		return fmt.Errorf("%v, did you mean %s?", err, in[:len(in)-len(name)]+similar)
+	}
+	return err
+}
+
+// similar returns the documented or declared name, or example, in m that is
+// closest to name, if it differs by no more than a quarter of its letters, or
+// one letter in a short name.
+func (m *CodeMap) similar(name string) string {
+	var best string
+	max := utf8.RuneCountInString(name) / 4
+	if max < 1 {
+		max = 1
+	}
+	try := func(key string) {
+		if d := editDistance(name, key); d < max || d == max && (best == "" || key < best) {
+			best, max = key, d
+		}
+	}
+	for key := range m.Comments {
+		try(key)
+	}
+	for key := range m.Decls {
+		try(key)
+	}
+	for key := range m.Examples {
+		try(key)
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range ra {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			cur[j+1] = prev[j] + cost
+			if prev[j+1]+1 < cur[j+1] {
+				cur[j+1] = prev[j+1] + 1
+			}
+			if cur[j]+1 < cur[j+1] {
+				cur[j+1] = cur[j] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// comment returns the doc comment for a possibly qualified name.
+func (m *CodeMap) comment(in string) (string, bool) {
+	p, name := m.lookup(in)
+	c, ok := p.Comments[name]
+	return c, ok
+}
+
+// example returns the example for a possibly qualified name.
+func (m *CodeMap) example(in string) (*doc.Example, bool) {
+	p, name := m.lookup(in)
+	e, ok := p.Examples[name]
+	return e, ok
+}
+
+// ExampleFunc returns a template function that renders the named example. If
+// plain is true the code is printed as is, otherwise the body is printed in a
+// fenced code block. It panics if the example is not found.
+//
+// The fenced code block can highlight lines of the body, e.g. "lines=3,5-7",
+// for renderers that support it. Lines past the end are ignored. With the
+// "imports" option the imports of the example program are printed above the
+// body, so it can be copied; this needs an example that go/doc can make into
+// a program (see doc.Example.Play). With the "full" option the whole program
+// is printed, as in PlaygroundFunc, and highlighted lines are numbered from the
+// start of the program.
+func (m *CodeMap) ExampleFunc(plain bool) func(in string, options ...string) string {
+	return func(in string, options ...string) string {
+		out, err := m.Example(in, plain, options...)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	}
+}
+
+// Example renders the named example. See ExampleFunc.
+func (m *CodeMap) Example(in string, plain bool, options ...string) (string, error) {
+	e, ok := m.example(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("example %s not found", in))
+	}
+	if plain || len(options) == 0 {
+		return m.renderExample(e, plain), nil
+	}
+	var imports, full bool
+	var highlight []string
+	for _, o := range options {
+		switch o {
+		case "imports":
+			imports = true
+		case "full":
+			full = true
+		default:
+			highlight = append(highlight, o)
+		}
+	}
+	code := m.printExample(e, false)
+	if full {
+		src, err := m.playSource(in)
+		if err != nil {
+			return "", err
+		}
+		code, imports = strings.TrimSuffix(src, "\n"), false
+	}
+	lines, err := parseHighlight(strings.Join(highlight, ","), strings.Count(code, "\n")+1)
+	if err != nil {
+		return "", err
+	}
+	if block := exampleImports(e); imports && block != "" {
+		code = block + "\n\n" + code
+		// lines are numbered from the start of the body
+		offset := strings.Count(block, "\n") + 2
+		for i := range lines {
+			lines[i][0] += offset
+			lines[i][1] += offset
+		}
+	}
+	return m.fenceHighlight(code, lines), nil
+}
+
+// exampleImports returns the import declaration of the program made from e by
+// go/doc, or an empty string if it has no imports.
+func exampleImports(e *doc.Example) string {
+	if e.Play == nil {
+		return ""
+	}
+	// go/doc doesn't fill in Play.Imports. As with goimports, the standard
+	// library is grouped first.
+	var std, other []string
+	for _, d := range e.Play.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			for _, s := range d.Specs {
+				s := s.(*ast.ImportSpec)
+				spec := s.Path.Value
+				if s.Name != nil {
+					spec = s.Name.Name + " " + spec
+				}
+				path, _ := strconv.Unquote(s.Path.Value)
+				if strings.Contains(strings.Split(path, "/")[0], ".") {
+					other = append(other, spec)
+				} else {
+					std = append(std, spec)
+				}
+			}
+		}
+	}
+	switch {
+	case len(std)+len(other) == 0:
+		return ""
+	case len(std)+len(other) == 1:
+		return "import " + append(std, other...)[0]
+	}
+	var groups []string
+	for _, g := range [][]string{std, other} {
+		if len(g) > 0 {
+			groups = append(groups, "\t"+strings.Join(g, "\n\t"))
+		}
+	}
+	return "import (\n" + strings.Join(groups, "\n\n") + "\n)"
+}
+
+// renderExample renders e as described in ExampleFunc.
+func (m *CodeMap) renderExample(e *doc.Example, plain bool) string {
+	if plain {
+		return m.printExample(e, true)
+	}
+	return m.fence(m.printExample(e, false))
+}
+
+// exampleKey identifies a printed example in the cache.
+type exampleKey struct {
+	e     *doc.Example
+	plain bool
+}
+
+// printExample returns the code of e, as is if plain is true, or as printed by
+// exampleCode. The printed code is cached, because templates often use the
+// same example more than once. The cache is keyed by the parsed example, so it
+// doesn't outlive the scan that found it.
+func (m *CodeMap) printExample(e *doc.Example, plain bool) string {
+	key := exampleKey{e, plain}
+	m.mu.RLock()
+	out, ok := m.printed[key]
+	m.mu.RUnlock()
+	if ok {
+		return out
+	}
+
+	if plain {
+		// the plain code doesn't include the expected output
+		buf := &bytes.Buffer{}
+		comments := withoutOutput(e)
+		code := e.Code
+		if b, ok := code.(*ast.BlockStmt); ok {
+			code = tightBlock(b, comments)
+		}
+		printer.Fprint(buf, m.fset, &printer.CommentedNode{Node: code, Comments: comments})
+		out = buf.String()
+	} else {
+		out = m.exampleCode(e, e.Comments)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.printed == nil {
+		m.printed = map[exampleKey]string{}
+	}
+	m.printed[key] = out
+	return out
+}
+
+// exampleCode prints the code of e with comments, without the braces of the
+// function body.
+func (m *CodeMap) exampleCode(e *doc.Example, comments []*ast.CommentGroup) string {
+	code := e.Code
+	if b, ok := code.(*ast.BlockStmt); ok {
+		code = tightBlock(b, comments)
+	}
+	buf := &bytes.Buffer{}
+	m.gofmt(buf, &printer.CommentedNode{Node: code, Comments: comments})
+	s := buf.String()
+	if _, ok := code.(*ast.BlockStmt); ok {
+		// We have to remove the block manually
+		// or comments don't print
+		s = strings.Replace(s[1:len(s)-1], "\n\t", "\n", -1)
+	}
+	// block and non-block code, e.g. a body printed on one line, are both
+	// printed at column zero
+	return strings.TrimSpace(strings.Join(deindent(strings.Split(s, "\n")), "\n"))
+}
+
+// gofmt prints node with the same settings as gofmt, which aligns with spaces
+// rather than tabs like printer.Fprint.
+func (m *CodeMap) gofmt(buf *bytes.Buffer, node *printer.CommentedNode) {
+	if err := format.Node(buf, m.fset, node); err != nil {
+		// format.Node fails for node types it doesn't support
+		buf.Reset()
+		printer.Fprint(buf, m.fset, node)
+	}
+}
+
+// ExampleWithOutputFunc returns the code of the named example in a code block,
+// followed by an "Output:" label (or "Unordered output:") and the expected
+// output in a plain code block. Examples with no output are printed as just
+// the code. It panics if the example is not found.
+func (m *CodeMap) ExampleWithOutputFunc(in string) string {
+	out, err := m.ExampleWithOutput(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// ExampleWithOutput renders the named example and its output. See
+// ExampleWithOutputFunc.
+func (m *CodeMap) ExampleWithOutput(in string) (string, error) {
+	e, ok := m.example(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("example %s not found", in))
+	}
+	return m.exampleWithOutput(e), nil
+}
+
+// exampleWithOutput renders e as described in ExampleWithOutputFunc.
+func (m *CodeMap) exampleWithOutput(e *doc.Example) string {
+	out := m.fence(m.exampleCode(e, withoutOutput(e)))
+	output := strings.Trim(e.Output, "\n")
+	if output == "" {
+		return out
+	}
+	label := "Output:"
+	if e.Unordered {
+		label = "Unordered output:"
+	}
+	if m.Format == HTML {
+		label = "<p>" + label + "</p>"
+	}
+	return out + "\n\n" + label + "\n\n" + m.plainFence(output)
+}
+
+// CollapsibleExampleFunc renders the named example like ExampleFunc, in a
+// collapsible section with the summary as its title: a <details> block, which
+// GitHub renders, or a collapsible block in AsciiDoc. It panics if the example
+// is not found, or the format is RST.
+func (m *CodeMap) CollapsibleExampleFunc(summary, in string) string {
+	out, err := m.CollapsibleExample(summary, in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// CollapsibleExample renders the named example in a collapsible section. See
+// CollapsibleExampleFunc.
+func (m *CodeMap) CollapsibleExample(summary, in string) (string, error) {
+	if m.Format == RST {
+		return "", errors.New("collapsible examples are not supported in RST")
+	}
+	out, err := m.Example(in, false)
+	if err != nil {
+		return "", err
+	}
+	if m.Format == AsciiDoc {
+		return "[%collapsible]\n." + summary + "\n====\n" + out + "\n====", nil
+	}
+	// markdown needs blank lines around the code block to render it inside an
+	// HTML block
+	return "<details>\n<summary>" + html.EscapeString(summary) + "</summary>\n\n" + out + "\n\n</details>", nil
+}
+
+// ExampleOrFunc renders the named example like ExampleFunc, or returns
+// fallback if the example is not found.
+func (m *CodeMap) ExampleOrFunc(in, fallback string) string {
+	out, _ := m.ExampleOr(in, fallback)
+	return out
+}
+
+// ExampleOr renders the named example, or returns fallback. See
+// ExampleOrFunc.
+func (m *CodeMap) ExampleOr(in, fallback string) (string, error) {
+	if _, ok := m.example(in); !ok {
+		return fallback, nil
+	}
+	return m.Example(in, false)
+}
+
+// PackageExampleFunc renders the package example, func Example(), like
+// ExampleFunc, e.g. to give it top billing in the readme. The options are as
+// for ExampleFunc. If the package has no package example an empty string is
+// returned. It panics if the options are invalid.
+func (m *CodeMap) PackageExampleFunc(options ...string) string {
+	out, err := m.PackageExample(options...)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// PackageExample renders the package example, or returns an empty string.
+// See PackageExampleFunc.
+func (m *CodeMap) PackageExample(options ...string) (string, error) {
+	if _, ok := m.Examples["Example"]; !ok {
+		return "", nil
+	}
+	return m.Example("Example", false, options...)
+}
+
+// OutputFunc returns the expected output of the named example. If a label is
+// given, e.g. "stderr:", only the lines starting with it are returned, with
+// the label and the spaces after it removed, e.g. to print a result and a log
+// line separately. It panics if the example is not found, or no lines have
+// the label.
+func (m *CodeMap) OutputFunc(in string, label ...string) string {
+	out, err := m.Output(in, label...)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Output returns the expected output of the named example. See OutputFunc.
+func (m *CodeMap) Output(in string, label ...string) (string, error) {
+	e, ok := m.example(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("example %s not found", in))
+	}
+	out := strings.Trim(e.Output, "\n")
+	if len(label) == 0 {
+		return out, nil
+	}
+	if len(label) > 1 || label[0] == "" {
+		return "", fmt.Errorf("invalid label %q for %s", label, in)
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, label[0]) {
+			lines = append(lines, strings.TrimLeft(strings.TrimPrefix(line, label[0]), " "))
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no output of %s labelled %s", in, label[0])
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// TruncatedOutputFunc returns the expected output of the named example like
+// OutputFunc, but only the first maxLines lines, followed by "... (N more
+// lines)". If a width is given, longer lines are wrapped first. It panics if
+// the example is not found.
+func (m *CodeMap) TruncatedOutputFunc(in string, maxLines int, width ...int) string {
+	out, err := m.TruncatedOutput(in, maxLines, width...)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// TruncatedOutput returns the truncated output of the named example. See
+// TruncatedOutputFunc. A maxLines of 0 prints all the lines.
+func (m *CodeMap) TruncatedOutput(in string, maxLines int, width ...int) (string, error) {
+	if maxLines < 0 {
+		return "", fmt.Errorf("invalid line count %d for %s", maxLines, in)
+	}
+	if len(width) > 1 || len(width) == 1 && width[0] <= 0 {
+		return "", fmt.Errorf("invalid width %v for %s", width, in)
+	}
+	out, err := m.Output(in)
+	if err != nil || out == "" {
+		return out, err
+	}
+	lines := strings.Split(out, "\n")
+	if len(width) == 1 {
+		lines = wrapLines(lines, width[0])
+	}
+	if maxLines == 0 || len(lines) <= maxLines {
+		return strings.Join(lines, "\n"), nil
+	}
+	more := len(lines) - maxLines
+	marker := fmt.Sprintf("... (%d more lines)", more)
+	if more == 1 {
+		marker = "... (1 more line)"
+	}
+	return strings.Join(append(lines[:maxLines:maxLines], marker), "\n"), nil
+}
+
+// wrapLines splits lines that are longer than width runes.
+func wrapLines(lines []string, width int) []string {
+	var out []string
+	for _, line := range lines {
+		r := []rune(line)
+		for len(r) > width {
+			out = append(out, string(r[:width]))
+			r = r[width:]
+		}
+		out = append(out, string(r))
+	}
+	return out
+}
+
+// ExampleNames returns the names of the examples in the package, sorted so
+// that method examples (ExampleType_Method) follow the examples for their
+// type.
+func (m *CodeMap) ExampleNames() []string {
+	var names []string
+	for name := range m.Examples {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.Split(names[i], "_"), strings.Split(names[j], "_")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return names
+}
+
+// ExampleListFunc renders every example in the package, in the order returned
+// by ExampleNames, as a heading followed by the code and expected output, as
+// printed by ExampleFunc.
+func (m *CodeMap) ExampleListFunc() string {
+	out, err := m.ExampleList()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// ExampleList renders every example in the package. See ExampleListFunc.
+func (m *CodeMap) ExampleList() (string, error) {
+	var sections []string
+	for _, name := range m.ExampleNames() {
+		code, err := m.Example(name, false)
+		if err != nil {
+			return "", err
+		}
+		sections = append(sections, m.heading(name)+"\n\n"+code)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// ExamplesFor returns the examples for the named declaration, e.g.
+// ExampleConn_Close and ExampleConn_Close_timeout for "Conn.Close", sorted by
+// suffix. The examples for the package are returned for "". As in go/doc, a
+// suffix starts with a lower case letter.
+func (m *CodeMap) ExamplesFor(in string) []*doc.Example {
+	var p *CodeMap
+	var name string
+	if in == "" {
+		p = m
+	} else {
+		p, name = m.lookup(in)
+	}
+	var out []*doc.Example
+	for _, e := range p.Examples {
+		if ident, _ := splitExampleName(e.Name); ident == name {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		_, a := splitExampleName(out[i].Name)
+		_, b := splitExampleName(out[j].Name)
+		return a < b
+	})
+	return out
+}
+
+// ExampleSuffix returns the suffix of the named example, e.g. "timeout" for
+// ExampleConn_Close_timeout.
+func ExampleSuffix(name string) string {
+	_, suffix := splitExampleName(strings.TrimPrefix(name, "Example"))
+	return suffix
+}
+
+// splitExampleName splits the name of an example, without the "Example"
+// prefix, into the declaration it documents and its suffix, e.g.
+// "Conn_Close_timeout" into "Conn.Close" and "timeout".
+func splitExampleName(name string) (ident, suffix string) {
+	if i := strings.LastIndex(name, "_"); i >= 0 && i+1 < len(name) && unicode.IsLower(rune(name[i+1])) {
+		name, suffix = name[:i], name[i+1:]
+	}
+	return strings.Replace(name, "_", ".", -1), suffix
+}
+
+// ExamplesForFunc renders all the examples for the named declaration, in the
+// order returned by ExamplesFor. When there is more than one, each is preceded
+// by a heading naming its suffix, e.g. "Example (Timeout)". It panics if there
+// are no examples.
+func (m *CodeMap) ExamplesForFunc(in string) string {
+	out, err := m.ExamplesForList(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// ExamplesForList renders all the examples for the named declaration. See
+// ExamplesForFunc.
+func (m *CodeMap) ExamplesForList(in string) (string, error) {
+	examples := m.ExamplesFor(in)
+	if len(examples) == 0 {
+		return "", fmt.Errorf("no examples found for %s", in)
+	}
+	if len(examples) == 1 {
+		return m.renderExample(examples[0], false), nil
+	}
+	var sections []string
+	for _, e := range examples {
+		title := "Example"
+		if _, suffix := splitExampleName(e.Name); suffix != "" {
+			title += " (" + strings.ToUpper(suffix[:1]) + suffix[1:] + ")"
+		}
+		sections = append(sections, m.heading(title)+"\n\n"+m.renderExample(e, false))
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// OutputUnorderedFunc reports whether the named example uses an "Unordered
+// output:" comment. It panics if the example is not found.
+func (m *CodeMap) OutputUnorderedFunc(in string) bool {
+	out, err := m.OutputUnordered(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// OutputUnordered reports whether the named example uses an "Unordered
+// output:" comment. See OutputUnorderedFunc.
+func (m *CodeMap) OutputUnordered(in string) (bool, error) {
+	e, ok := m.example(in)
+	if !ok {
+		return false, m.notFound(in, fmt.Errorf("example %s not found", in))
+	}
+	return e.Unordered, nil
+}
+
+var docRegex = regexp.MustCompile(`^([\w./]+)\[([0-9:, -]+)\]$`)
+var wordRegex = regexp.MustCompile(`^([\w./]+)\{([0-9:, -]+)\}$`)
+var paragraphRegex = regexp.MustCompile(`^([\w./]+)¶\[([0-9:, -]+)\]$`)
+
+// DocFunc returns the documentation for the named declaration. Sentances can
+// be selected with "Name[i:j]", words with "Name{i:j}" and paragraphs with
+// "Name¶[i:j]". It panics if the declaration is not found.
+func (m *CodeMap) DocFunc(in string) string {
+	out, err := m.Doc(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Doc returns the documentation for the named declaration. See DocFunc.
+func (m *CodeMap) Doc(in string) (string, error) {
+	return m.extractDoc(in, m.docRenderer())
+}
+
+// docRenderer returns the renderer used for docs, as configured by m.Format,
+// m.Linkify, m.RenderMarkdown, m.FenceChar and m.FenceLang. With
+// RenderMarkdown and the markdown format it renders docs as CommentToMarkdown
+// does, but doc links are only converted if they are found in the package.
+func (m *CodeMap) docRenderer() docRenderer {
+	r := docRenderer{
+		format:    m.Format,
+		markdown:  m.RenderMarkdown,
+		linkify:   m.Linkify,
+		fenceChar: m.FenceChar,
+		fenceLang: m.FenceLang,
+	}
+	if m.RenderMarkdown {
+		r.resolve = m.docLinkURL
+	}
+	return r
+}
+
+// DocOrFunc returns the documentation for the named declaration like DocFunc,
+// or fallback if it isn't documented, e.g. for optional sections. The fallback
+// can be empty to omit the section. It panics on other errors, e.g. a
+// sentance selector that is out of range.
+func (m *CodeMap) DocOrFunc(in, fallback string) string {
+	out, err := m.DocOr(in, fallback)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// DocOr returns the documentation for the named declaration, or fallback. See
+// DocOrFunc.
+func (m *CodeMap) DocOr(in, fallback string) (string, error) {
+	if _, ok := m.comment(docName(in)); !ok {
+		return fallback, nil
+	}
+	return m.Doc(in)
+}
+
+// docName returns the name of the declaration in in, without any sentance,
+// word or paragraph selector.
+func docName(in string) string {
+	if matches := docRegex.FindStringSubmatch(in); matches != nil {
+		return matches[1]
+	}
+	if matches := wordRegex.FindStringSubmatch(in); matches != nil {
+		return matches[1]
+	}
+	if matches := paragraphRegex.FindStringSubmatch(in); matches != nil {
+		return matches[1]
+	}
+	return in
+}
+
+// extractDoc looks up the documentation for in and applies any sentance, word
+// or paragraph selector. The doc is rendered by r.
+func (m *CodeMap) extractDoc(in string, r docRenderer) (string, error) {
+
+	if matches := wordRegex.FindStringSubmatch(in); matches != nil {
+		id := matches[1]
+		c, ok := m.comment(id)
+		if !ok {
+			return "", m.notFound(id, fmt.Errorf("doc for %s not found in %s", id, in))
+		}
+		out, err := extractWords(in, matches[2], m.docText(c, id))
+		if err != nil {
+			return "", err
+		}
+		if r.format == HTML {
+			// as in the blocks rendered for the other selectors
+			out = html.EscapeString(out)
+		}
+		return r.inline(out), nil
+	}
+
+	if matches := docRegex.FindStringSubmatch(in); matches != nil {
+		id := matches[1]
+		c, ok := m.comment(id)
+		if !ok {
+			return "", m.notFound(id, fmt.Errorf("doc for %s not found in %s", id, in))
+		}
+		return extractBlockSections(in, matches[2], parseBlocks(m.docText(c, id), r.markdown), r)
+	}
+
+	if matches := paragraphRegex.FindStringSubmatch(in); matches != nil {
+		id := matches[1]
+		c, ok := m.comment(id)
+		if !ok {
+			return "", m.notFound(id, fmt.Errorf("doc for %s not found in %s", id, in))
+		}
+		return extractBlockParagraphs(in, matches[2], parseBlocks(m.docText(c, id), r.markdown), r)
+	}
+
+	c, ok := m.comment(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("doc for %s not found", in))
+	}
+	return r.render(m.docText(c, in)), nil
+}
+
+// PackageDocFunc returns the package comment. As in go/doc, the comments on
+// the package clauses of the files are joined, unless doc.go has one, in which
+// case only that is used. It panics if there is no package comment.
+func (m *CodeMap) PackageDocFunc() string {
+	out, err := m.PackageDoc()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// PackageDoc returns the package comment. See PackageDocFunc.
+func (m *CodeMap) PackageDoc() (string, error) {
+	if m.packageDoc == "" {
+		return "", fmt.Errorf("package doc for %s not found", m.pkg)
+	}
+	return m.docRenderer().render(m.packageDoc), nil
+}
+
+// docText returns the doc comment of in, cleaned up as requested by
+// m.StripDeprecated and m.StripIdentPrefix.
+func (m *CodeMap) docText(comment, in string) string {
+	if m.StripDeprecated {
+		_, comment = splitDeprecated(comment)
+	}
+	return m.stripIdent(comment, in)
+}
+
+// DeprecatedFunc returns the "Deprecated: ..." paragraph of the documentation
+// for the named declaration, or an empty string if it isn't deprecated. It
+// panics if the declaration is not documented.
+func (m *CodeMap) DeprecatedFunc(in string) string {
+	out, err := m.Deprecated(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Deprecated returns the deprecation notice of the named declaration. See
+// DeprecatedFunc.
+func (m *CodeMap) Deprecated(in string) (string, error) {
+	c, ok := m.comment(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("doc for %s not found", in))
+	}
+	notice, _ := splitDeprecated(c)
+	if notice == "" {
+		return "", nil
+	}
+	return docRenderer{format: m.Format, fenceChar: m.FenceChar, fenceLang: m.FenceLang}.render(notice), nil
+}
+
+// splitDeprecated returns the paragraph of the comment starting
+// "Deprecated:", which runs until the next blank line, and the rest of the
+// comment.
+func splitDeprecated(comment string) (notice, rest string) {
+	paragraphs := strings.SplitAfter(comment, "\n\n")
+	for i, p := range paragraphs {
+		if strings.HasPrefix(p, "Deprecated:") {
+			rest := strings.Join(append(paragraphs[:i:i], paragraphs[i+1:]...), "")
+			return strings.TrimSpace(p), strings.TrimRight(rest, "\n") + "\n"
+		}
+	}
+	return "", comment
+}
+
+// stripIdent removes the name of the declaration from the start of its doc
+// comment if m.StripIdentPrefix is set, so "Close closes the connection."
+// becomes "Closes the connection.".
+func (m *CodeMap) stripIdent(comment, in string) string {
+	if !m.StripIdentPrefix {
+		return comment
+	}
+	ident := in[strings.LastIndex(in, ".")+1:]
+	rest := strings.TrimPrefix(comment, ident)
+	if rest == comment || rest == "" || !unicode.IsSpace(rune(rest[0])) {
+		// not the whole word, e.g. "Closer" for "Close"
+		return comment
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	r, size := utf8.DecodeRuneInString(rest)
+	return string(unicode.ToUpper(r)) + rest[size:]
+}
+
+// SynopsisFunc returns the first sentance of the documentation for the named
+// declaration, as determined by go/doc. It panics if the declaration is not
+// found.
+func (m *CodeMap) SynopsisFunc(in string) string {
+	out, err := m.Synopsis(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Synopsis returns the first sentance of the documentation for the named
+// declaration. See SynopsisFunc.
+func (m *CodeMap) Synopsis(in string) (string, error) {
+	c, ok := m.comment(in)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("doc for %s not found", in))
+	}
+	return new(doc.Package).Synopsis(c), nil
+}
+
+// DefaultWordsPerMinute is the reading speed used by ReadingTimeFunc when wpm
+// is not positive.
+const DefaultWordsPerMinute = 200
+
+// WordCountFunc returns the number of words in the documentation for the named
+// declaration. Sentances can be selected as in DocFunc, e.g. "Foo[0:5]". It
+// panics if the declaration is not found.
+func (m *CodeMap) WordCountFunc(in string) int {
+	out, err := m.WordCount(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// WordCount returns the number of words in the documentation for the named
+// declaration. See WordCountFunc.
+func (m *CodeMap) WordCount(in string) (int, error) {
+	out, err := m.extractDoc(in, docRenderer{format: m.Format, markdown: m.RenderMarkdown})
+	if err != nil {
+		return 0, err
+	}
+	return len(strings.Fields(out)), nil
+}
+
+// ReadingTimeFunc returns the estimated time to read the documentation for the
+// named declaration at wpm words per minute, e.g. "3 min read". It panics if
+// the declaration is not found.
+func (m *CodeMap) ReadingTimeFunc(in string, wpm int) string {
+	out, err := m.ReadingTime(in, wpm)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// ReadingTime returns the estimated time to read the documentation for the
+// named declaration. See ReadingTimeFunc.
+func (m *CodeMap) ReadingTime(in string, wpm int) (string, error) {
+	words, err := m.WordCount(in)
+	if err != nil {
+		return "", err
+	}
+	if wpm <= 0 {
+		wpm = DefaultWordsPerMinute
+	}
+	minutes := (words + wpm - 1) / wpm
+	if minutes < 1 {
+		minutes = 1
+	}
+	return fmt.Sprintf("%d min read", minutes), nil
+}
+
+// SignatureFunc returns the signature of the named function or method (e.g.
+// "Conn.Close") in a fenced code block. Type aliases, and other types that
+// aren't structs or interfaces, are printed as their declaration, e.g. "type
+// Reader = io.Reader". It panics if the function is not found.
+func (m *CodeMap) SignatureFunc(in string) string {
+	out, err := m.Signature(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Signature returns the signature of the named function or method. See
+// SignatureFunc. Interface methods are printed as they appear in the
+// interface, e.g. "Read(p []byte) (n int, err error)".
+func (m *CodeMap) Signature(in string) (string, error) {
+	p, name := m.lookup(in)
+	var sig ast.FuncDecl
+	var method bool
+	switch d := p.Decls[name].(type) {
+	case *ast.FuncDecl:
+		// print a copy without the doc or body
+		sig = *d
+		sig.Doc = nil
+		sig.Body = nil
+	case *ast.Field:
+		t, ok := d.Type.(*ast.FuncType)
+		if !ok {
+			// an embedded interface
+			return "", m.notFound(in, fmt.Errorf("function %s not found", in))
+		}
+		sig = ast.FuncDecl{Name: ast.NewIdent(name[strings.LastIndex(name, ".")+1:]), Type: t}
+		method = true
+	case *ast.GenDecl:
+		// type aliases and other types that fit on a line, e.g. "type Kind int"
+		s, ok := typeSpec(d)
+		if !ok {
+			return "", m.notFound(in, fmt.Errorf("function %s not found", in))
+		}
+		switch s.Type.(type) {
+		case *ast.StructType, *ast.InterfaceType:
+			return "", fmt.Errorf("%s is a struct or interface, see DeclFunc", in)
+		}
+		spec := *s
+		spec.Doc, spec.Comment = nil, nil
+		buf := &bytes.Buffer{}
+		if err := printer.Fprint(buf, p.fset, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{&spec}}); err != nil {
+			return "", fmt.Errorf("failed to print signature for %s: %v", in, err)
+		}
+		return m.fence(buf.String()), nil
+	default:
+		return "", m.notFound(in, fmt.Errorf("function %s not found", in))
+	}
+	buf := &bytes.Buffer{}
+	if err := printer.Fprint(buf, p.fset, &sig); err != nil {
+		return "", fmt.Errorf("failed to print signature for %s: %v", in, err)
+	}
+	out := buf.String()
+	if method {
+		out = strings.TrimPrefix(out, "func ")
+	}
+	return m.fence(out), nil
+}
+
+// typeSpec returns the type declared by d, if it is a type declaration.
+func typeSpec(d *ast.GenDecl) (*ast.TypeSpec, bool) {
+	if d.Tok != token.TYPE || len(d.Specs) != 1 {
+		return nil, false
+	}
+	s, ok := d.Specs[0].(*ast.TypeSpec)
+	return s, ok
+}
+
+// AliasTargetFunc returns the type that the named type alias refers to, e.g.
+// "io.Reader" for "type Reader = io.Reader". It panics if the type is not an
+// alias.
+func (m *CodeMap) AliasTargetFunc(in string) string {
+	out, err := m.AliasTarget(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// AliasTarget returns the target of the named type alias. See
+// AliasTargetFunc.
+func (m *CodeMap) AliasTarget(in string) (string, error) {
+	p, name := m.lookup(in)
+	d, ok := p.Decls[name].(*ast.GenDecl)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("type %s not found", in))
+	}
+	s, ok := typeSpec(d)
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("type %s not found", in))
+	}
+	if !s.Assign.IsValid() {
+		return "", fmt.Errorf("%s is not a type alias", in)
+	}
+	buf := &bytes.Buffer{}
+	if err := printer.Fprint(buf, p.fset, s.Type); err != nil {
+		return "", fmt.Errorf("failed to print alias target for %s: %v", in, err)
+	}
+	return buf.String(), nil
+}
+
+// MethodsFunc returns the signatures of the exported methods of the named type,
+// including interface methods, sorted by name, each followed by the first
+// sentance of its documentation. It panics if there are none.
+func (m *CodeMap) MethodsFunc(typeName string) string {
+	out, err := m.Methods(typeName)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Methods returns the methods of the named type. See MethodsFunc.
+func (m *CodeMap) Methods(typeName string) (string, error) {
+	p, name := m.lookup(typeName)
+	qualifier := typeName[:len(typeName)-len(name)]
+	var names []string
+	for key, d := range p.Decls {
+		var method string
+		if strings.HasPrefix(key, name+".") {
+			method = key[len(name)+1:]
+		} else if strings.HasPrefix(key, "(*"+name+").") {
+			method = key[len(name)+4:]
+		} else {
+			continue
+		}
+		if !ast.IsExported(method) {
+			continue
+		}
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+		case *ast.Field:
+			if _, ok := d.Type.(*ast.FuncType); !ok {
+				// an embedded interface
+				continue
+			}
+		default:
+			continue
+		}
+		names = append(names, key)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no methods of %s found", typeName)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := names[i][strings.LastIndex(names[i], ".")+1:], names[j][strings.LastIndex(names[j], ".")+1:]
+		if a != b {
+			return a < b
+		}
+		// the value method before the pointer method
+		return names[i] > names[j]
+	})
+	var out []string
+	for _, key := range names {
+		sig, err := m.Signature(qualifier + key)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, sig)
+		if c, ok := p.Comments[key]; ok {
+			synopsis := new(doc.Package).Synopsis(c)
+			if m.Format == HTML {
+				synopsis = "<p>" + html.EscapeString(synopsis) + "</p>"
+			}
+			out = append(out, synopsis)
+		}
+	}
+	return strings.Join(out, "\n\n"), nil
+}
+
+// FieldsFunc returns a table of the exported fields of the named struct type,
+// with their types and the first sentance of their documentation. Embedded
+// fields are named after their type. It panics if the type is not a struct or
+// has no exported fields.
+func (m *CodeMap) FieldsFunc(typeName string) string {
+	out, err := m.Fields(typeName)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Fields returns a table of the fields of the named struct type. See
+// FieldsFunc.
+func (m *CodeMap) Fields(typeName string) (string, error) {
+	p, name := m.lookup(typeName)
+	d, ok := p.Decls[name].(*ast.GenDecl)
+	if !ok || d.Tok != token.TYPE {
+		return "", m.notFound(typeName, fmt.Errorf("type %s not found", typeName))
+	}
+	t, ok := d.Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+	if !ok {
+		return "", fmt.Errorf("%s is not a struct", typeName)
+	}
+	var rows [][]string
+	for _, f := range t.Fields.List {
+		names := f.Names
+		if len(names) == 0 {
+			if id := baseTypeName(f.Type); id != nil {
+				names = []*ast.Ident{id}
+			}
+		}
+		buf := &bytes.Buffer{}
+		printer.Fprint(buf, p.fset, f.Type)
+		typ := strings.Join(strings.Fields(buf.String()), " ")
+		c := commentText(f.Doc)
+		if c == "" {
+			c = commentText(f.Comment)
+		}
+		synopsis := new(doc.Package).Synopsis(c)
+		for _, n := range names {
+			if n.IsExported() {
+				rows = append(rows, []string{n.Name, typ, synopsis})
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no exported fields of %s found", typeName)
+	}
+	return m.table([]string{"Field", "Type", "Description"}, rows), nil
+}
+
+// DeclFunc returns the source of the named declaration in a fenced code
+// block. Types are rendered with their fields or methods and comments, and
+// consts and vars with the rest of their group. It panics if the declaration
+// is not found.
+func (m *CodeMap) DeclFunc(in string) string {
+	out, err := m.Decl(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Decl returns the source of the named declaration. See DeclFunc.
+func (m *CodeMap) Decl(in string) (string, error) {
+	p, name := m.lookup(in)
+	node, ok := p.Decls[name]
+	if !ok {
+		return "", m.notFound(in, fmt.Errorf("declaration %s not found", in))
+	}
+	// print a copy without the doc comment
+	switch d := node.(type) {
+	case *ast.GenDecl:
+		c := *d
+		c.Doc = nil
+		node = &c
+	case *ast.FuncDecl:
+		c := *d
+		c.Doc = nil
+		node = &c
+	}
+	buf := &bytes.Buffer{}
+	if err := format.Node(buf, p.fset, &printer.CommentedNode{Node: node, Comments: p.commentsIn(node)}); err != nil {
+		return "", fmt.Errorf("failed to format declaration %s: %v", in, err)
+	}
+	return m.fence(buf.String()), nil
+}
+
+// DefaultGodocURL is the base URL used by LinkFunc when CodeMap.GodocURL is
+// empty.
+const DefaultGodocURL = "https://pkg.go.dev/"
+
+// LinkFunc returns a markdown link to the documentation for the named
+// declaration, e.g. [Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close).
+// It panics if the declaration is not found.
+func (m *CodeMap) LinkFunc(in string) string {
+	out, err := m.Link(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Link returns a markdown link to the documentation for the named
+// declaration. See LinkFunc.
+func (m *CodeMap) Link(in string) (string, error) {
+	p, name := m.lookup(in)
+	_, documented := p.Comments[name]
+	_, declared := p.Decls[name]
+	if name == "" || (!documented && !declared) {
+		return "", m.notFound(in, fmt.Errorf("declaration %s not found", in))
+	}
+	return fmt.Sprintf("[%s](%s%s#%s)", in, m.godocURL(), p.pkg, name), nil
+}
+
+// godocURL returns GodocURL, or DefaultGodocURL, with a trailing slash.
+func (m *CodeMap) godocURL() string {
+	base := m.GodocURL
+	if base == "" {
+		base = DefaultGodocURL
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
+// ImportFunc returns the import statement for the package in a fenced code
+// block. If an alias is given, or the package name differs from the last
+// element of the import path, the import is named.
+func (m *CodeMap) ImportFunc(alias ...string) string {
+	out, err := m.Import(alias...)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Import returns the import statement for the package. See ImportFunc.
+func (m *CodeMap) Import(alias ...string) (string, error) {
+	if len(alias) > 1 {
+		return "", fmt.Errorf("import takes at most one alias, found %d", len(alias))
+	}
+	if m.pkg == "" || strings.HasPrefix(m.pkg, ".") || filepath.IsAbs(m.pkg) {
+		// no import path was given, so the best we can do is the name
+		return m.fence(fmt.Sprintf("import %q // import path unknown, package %s", m.Name, m.Name)), nil
+	}
+	name := ""
+	if len(alias) == 1 {
+		name = alias[0]
+	} else if m.Name != "" && m.Name != importBase(m.pkg) {
+		name = m.Name
+	}
+	if name != "" {
+		return m.fence(fmt.Sprintf("import %s %q", name, m.pkg)), nil
+	}
+	return m.fence(fmt.Sprintf("import %q", m.pkg)), nil
+}
+
+// importBase returns the last element of an import path, skipping a major
+// version suffix, e.g. "jen" for "github.com/dave/jennifer/jen" and "yaml" for
+// "gopkg.in/yaml.v3".
+func importBase(pkg string) string {
+	base := path.Base(pkg)
+	if majorRegex.MatchString(base) && strings.Contains(pkg, "/") {
+		base = path.Base(path.Dir(pkg))
+	}
+	if i := strings.Index(base, ".v"); i > 0 && strings.HasPrefix(pkg, "gopkg.in/") {
+		base = base[:i]
+	}
+	return base
+}
+
+var majorRegex = regexp.MustCompile(`^v[0-9]+$`)
+
+// BodyFunc returns the body of the named function or method in a fenced code
+// block, without the outer braces. It panics if the function is not found.
+func (m *CodeMap) BodyFunc(in string) string {
+	out, err := m.Body(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Body returns the body of the named function or method. See BodyFunc.
+func (m *CodeMap) Body(in string) (string, error) {
+	p, name := m.lookup(in)
+	f, ok := p.Decls[name].(*ast.FuncDecl)
+	if !ok || f.Body == nil {
+		return "", m.notFound(in, fmt.Errorf("function %s not found", in))
+	}
+	comments := p.commentsIn(f.Body)
+	buf := &bytes.Buffer{}
+	if err := printer.Fprint(buf, p.fset, &printer.CommentedNode{Node: tightBlock(f.Body, comments), Comments: comments}); err != nil {
+		return "", fmt.Errorf("failed to print body of %s: %v", in, err)
+	}
+	// remove the block manually, as in Example
+	s := buf.String()
+	s = s[1 : len(s)-1]
+	s = strings.TrimSpace(strings.Replace(s, "\n\t", "\n", -1))
+	return m.fence(s), nil
 }
 
-func (m *CodeMap) ExampleFunc(plain bool) func(in string) string {
-	return func(in string) string {
-		e, ok := m.Examples[in]
-		if !ok {
-			panic(fmt.Sprintf("Example %s not found.", in))
+// commentsIn returns the comments inside node.
+func (m *CodeMap) commentsIn(node ast.Node) []*ast.CommentGroup {
+	var out []*ast.CommentGroup
+	for _, f := range m.files {
+		if node.Pos() < f.Pos() || node.End() > f.End() {
+			continue
 		}
-		buf := &bytes.Buffer{}
-
-		cn := &printer.CommentedNode{e.Code, e.Comments}
-
-		if plain {
-			printer.Fprint(buf, m.fset, cn)
-			out := buf.String()
-			if strings.HasSuffix(out, "\n\n}") {
-				// fix annoying line-feed before end brace
-				out = out[:len(out)-2] + "}"
+		for _, c := range f.Comments {
+			if c.Pos() >= node.Pos() && c.End() <= node.End() {
+				out = append(out, c)
 			}
-			o := "\n\t// Output:"
-			if strings.Contains(out, o) {
-				// Nasty kludge to remove the output...
-				// TODO: Fix this
-				out = out[:strings.Index(out, o)] + "\n}"
-			}
-			return out
-		}
-
-		if _, ok := e.Code.(*ast.BlockStmt); ok {
-			// We have to remove the block manually
-			// or comments don't print
-			buf1 := &bytes.Buffer{}
-			printer.Fprint(buf1, m.fset, cn)
-			s := buf1.String()
-			s = s[1 : len(s)-1]
-			s = strings.TrimSpace(strings.Replace(s, "\n\t", "\n", -1))
-			buf.WriteString(s)
-		} else {
-			printer.Fprint(buf, m.fset, cn)
 		}
-
-		return fmt.Sprintf("```go\n%s\n```", strings.Trim(buf.String(), "\n"))
-
 	}
+	return out
 }
 
-func (m *CodeMap) OutputFunc(in string) string {
-	e, ok := m.Examples[in]
-	if !ok {
-		panic(fmt.Sprintf("Example %s not found.", in))
+// NotesFunc returns a markdown list of the notes in the package with the
+// specified marker, e.g. "BUG" for "BUG(who): ..." comments. If there are no
+// notes it returns an empty string.
+func (m *CodeMap) NotesFunc(marker string) string {
+	var out []string
+	for _, n := range m.Notes[marker] {
+		body := strings.Join(strings.Fields(n.Body), " ")
+		if n.UID == "" {
+			out = append(out, "- "+body)
+			continue
+		}
+		out = append(out, fmt.Sprintf("- %s: %s", n.UID, body))
 	}
-	return strings.Trim(e.Output, "\n")
+	return strings.Join(out, "\n")
 }
 
-var docRegex = regexp.MustCompile(`(\w+)\[([0-9:, ]+)\]`)
-
-func (m *CodeMap) DocFunc(in string) string {
-
-	if matches := docRegex.FindStringSubmatch(in); matches != nil {
-		id := matches[1]
-		c, ok := m.Comments[id]
-		if !ok {
-			panic(fmt.Sprintf("Doc for %s not found in %s.", id, in))
-		}
-		return extractSections(in, matches[2], c)
+// PlaygroundFunc returns the named example as a complete program in the Go
+// Playground format. It panics if the example is not found.
+func (m *CodeMap) PlaygroundFunc(in string) string {
+	out, err := m.Playground(in)
+	if err != nil {
+		panic(err)
 	}
+	return out
+}
 
-	c, ok := m.Comments[in]
-	if !ok {
-		panic(fmt.Sprintf("Doc for %s not found.", in))
+// Playground returns the named example in the Go Playground format. See
+// PlaygroundFunc. In the RST and HTML formats the program is printed in a
+// code block, because it can't be indented or escaped by the template.
+func (m *CodeMap) Playground(in string) (string, error) {
+	src, err := m.playSource(in)
+	if err != nil {
+		return "", err
 	}
-	return strings.Trim(c, "\n")
+	if m.Format == RST || m.Format == HTML {
+		return m.fence(src), nil
+	}
+	return src, nil
 }
 
-func (m *CodeMap) PlaygroundFunc(in string) string {
-	e, ok := m.Examples[in]
+// playSource returns the named example as a complete program.
+func (m *CodeMap) playSource(in string) (string, error) {
+	e, ok := m.example(in)
 	if !ok {
-		panic(fmt.Sprintf("Example %s not found.", in))
+		return "", m.notFound(in, fmt.Errorf("example %s not found", in))
+	}
+	if e.Play == nil {
+		// go/doc couldn't build a runnable program, e.g. because the example
+		// is in the package under test rather than an external _test package.
+		return "", fmt.Errorf("example %s has no playable form: examples must be in a _test package and only use exported identifiers", in)
+	}
+
+	// copy the file so the example isn't modified
+	play := *e.Play
+	play.Decls = make([]ast.Decl, len(e.Play.Decls))
+	for i, d := range e.Play.Decls {
+		if f, ok := d.(*ast.FuncDecl); ok && f.Name.Name == "main" && f.Recv == nil && f.Body != nil {
+			main := *f
+			main.Body = tightBlock(f.Body, play.Comments)
+			d = &main
+		}
+		play.Decls[i] = d
 	}
 
 	var buf bytes.Buffer
-	if err := format.Node(&buf, m.fset, e.Play); err != nil {
-		panic(fmt.Sprintf("Failed to format code for %s: %v", in, err))
+	if err := format.Node(&buf, m.fset, &play); err != nil {
+		return "", fmt.Errorf("failed to format code for %s: %v", in, err)
 	}
 
-	out := buf.String()
-	if strings.HasSuffix(out, "\n\n}\n") {
-		// fix annoying line-feed before end brace
-		out = out[:len(out)-3] + "}"
+	// end with the closing brace, without a trailing newline
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// outputRegex matches the comment holding the expected output of an example,
+// as in go/doc.
+var outputRegex = regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+
+// withoutOutput returns the comments of an example, excluding the expected
+// output. Like go/doc, the output must be the last comment in the body.
+func withoutOutput(e *doc.Example) []*ast.CommentGroup {
+	var last int = -1
+	for i, c := range e.Comments {
+		if c.Pos() >= e.Code.Pos() && c.End() <= e.Code.End() {
+			last = i
+		}
+	}
+	if last == -1 || !outputRegex.MatchString(e.Comments[last].Text()) {
+		return e.Comments
 	}
+	var out []*ast.CommentGroup
+	out = append(out, e.Comments[:last]...)
+	return append(out, e.Comments[last+1:]...)
+}
 
-	return out
+// tightBlock returns a copy of b with the closing brace moved to the end of
+// the last statement or comment in the block, so the printer doesn't leave
+// blank lines before it.
+func tightBlock(b *ast.BlockStmt, comments []*ast.CommentGroup) *ast.BlockStmt {
+	end := b.Lbrace + 1
+	if len(b.List) > 0 {
+		end = b.List[len(b.List)-1].End()
+	}
+	for _, c := range comments {
+		if c.End() > end && c.End() <= b.Rbrace {
+			end = c.End()
+		}
+	}
+	tight := *b
+	tight.Rbrace = end
+	return &tight
 }
 
-var bothRegex = regexp.MustCompile(`^(\d+):(\d+)$`)
-var fromRegex = regexp.MustCompile(`^(\d+):$`)
-var toRegex = regexp.MustCompile(`^:(\d+)$`)
-var singleRegex = regexp.MustCompile(`^(\d+)$`)
+var bothRegex = regexp.MustCompile(`^(-?\d+):(-?\d+)$`)
+var fromRegex = regexp.MustCompile(`^(-?\d+):$`)
+var toRegex = regexp.MustCompile(`^:(-?\d+)$`)
+var singleRegex = regexp.MustCompile(`^(-?\d+)$`)
 
 func mustInt(s string) int {
 	i, err := strconv.Atoi(s)
@@ -144,67 +1797,298 @@ func mustInt(s string) int {
 	return i
 }
 
-func checkBounds(start, end, length int, spec string) {
+// parseIndex parses an index from a section spec. Negative indices count back
+// from the end of a list of the specified length.
+func parseIndex(s string, length int, spec string) (int, error) {
+	i := mustInt(s)
+	if i >= 0 {
+		return i, nil
+	}
+	if i+length < 0 {
+		return 0, fmt.Errorf("index %d out of range (length %d) in %s", i, length, spec)
+	}
+	return i + length, nil
+}
+
+func checkBounds(start, end, length int, spec string) error {
 
 	if end == 0 {
-		panic(fmt.Sprintf("End must be greater than 0 in %s", spec))
+		return fmt.Errorf("end must be greater than 0 in %s", spec)
 	}
 
 	if start >= length {
-		panic(fmt.Sprintf("Index %d out of range (length %d) in %s", start, length, spec))
+		return fmt.Errorf("index %d out of range (length %d) in %s", start, length, spec)
 	}
 
 	if end >= length {
-		panic(fmt.Sprintf("Index %d out of range (length %d) in %s", end, length, spec))
+		return fmt.Errorf("index %d out of range (length %d) in %s", end, length, spec)
 	}
 
 	if end > -1 && start >= end {
-		panic(fmt.Sprintf("Start must be less than end in %s", spec))
+		return fmt.Errorf("start must be less than end in %s", spec)
 	}
-}
 
-func extractSections(full string, sections string, comment string) string {
-
-	var sentances []string
-	for _, s := range strings.Split(comment, ".") {
-		// ignore empty sentances
-		trimmed := strings.Trim(s, " \n")
-		if trimmed != "" {
-			sentances = append(sentances, s)
-		}
-	}
+	return nil
+}
 
-	var out string
+// sectionRanges parses a comma separated list of sections using Go slice
+// notation ("i", "i:j", "i:" or ":j") and returns the [start, end) range of
+// each section in a list of the specified length. Negative indices count back
+// from the end of the list, so "-1" is the last item.
+func sectionRanges(full string, sections string, length int) ([][2]int, error) {
+	var out [][2]int
 	for _, section := range strings.Split(sections, ",") {
-		var arr []string
+		start, end, single := -1, -1, false
+		var err error
 		if matches := bothRegex.FindStringSubmatch(section); matches != nil {
 			// "i:j"
-			checkBounds(mustInt(matches[1]), mustInt(matches[2]), len(sentances), full)
-			arr = sentances[mustInt(matches[1]):mustInt(matches[2])]
+			if start, err = parseIndex(matches[1], length, full); err != nil {
+				return nil, err
+			}
+			if end, err = parseIndex(matches[2], length, full); err != nil {
+				return nil, err
+			}
 		} else if matches := fromRegex.FindStringSubmatch(section); matches != nil {
 			// "i:"
-			checkBounds(mustInt(matches[1]), -1, len(sentances), full)
-			arr = sentances[mustInt(matches[1]):]
+			if start, err = parseIndex(matches[1], length, full); err != nil {
+				return nil, err
+			}
 		} else if matches := toRegex.FindStringSubmatch(section); matches != nil {
 			// ":i"
-			checkBounds(-1, mustInt(matches[1]), len(sentances), full)
-			arr = sentances[:mustInt(matches[1])]
+			if end, err = parseIndex(matches[1], length, full); err != nil {
+				return nil, err
+			}
 		} else if matches := singleRegex.FindStringSubmatch(section); matches != nil {
 			// "i"
-			checkBounds(mustInt(matches[1]), -1, len(sentances), full)
-			arr = []string{sentances[mustInt(matches[1])]}
+			if start, err = parseIndex(matches[1], length, full); err != nil {
+				return nil, err
+			}
+			single = true
 		} else {
-			panic(fmt.Sprintf("Invalid section %s in %s", section, full))
+			return nil, fmt.Errorf("invalid section %s in %s", section, full)
+		}
+		if err := checkBounds(start, end, length, full); err != nil {
+			return nil, err
 		}
+		switch {
+		case single:
+			end = start + 1
+		case start == -1:
+			start = 0
+		case end == -1:
+			end = length
+		}
+		out = append(out, [2]int{start, end})
+	}
+	return out, nil
+}
+
+// sentance is a sentance of a doc comment, or a whole code block, heading or
+// list, which are never split.
+type sentance struct {
+	text  string
+	block bool
+	// paragraph is the index of the block the sentance is in.
+	paragraph int
+}
+
+func extractSections(full string, sections string, comment string) (string, error) {
+	return extractBlockSections(full, sections, parseBlocks(comment, false), docRenderer{format: Markdown})
+}
+
+// extractBlockSections selects sentances from the prose blocks of a parsed
+// doc comment. Other blocks count as a single sentance. Sentances from the
+// same paragraph are joined by a space, and from different paragraphs by a
+// blank line.
+func extractBlockSections(full string, sections string, blocks []docBlock, r docRenderer) (string, error) {
+
+	var sentances []sentance
+	for i, b := range blocks {
+		if b.kind != proseBlock {
+			sentances = append(sentances, sentance{text: r.text(b), block: true, paragraph: i})
+			continue
+		}
+		for _, s := range splitSentences(r.text(b)) {
+			// ignore empty sentances
+			trimmed := strings.TrimSpace(s)
+			if trimmed != "" {
+				sentances = append(sentances, sentance{text: trimmed, paragraph: i})
+			}
+		}
+	}
+
+	ranges, err := sectionRanges(full, sections, len(sentances))
+	if err != nil {
+		return "", err
+	}
 
-		for _, s := range arr {
-			s1 := strings.Trim(s, " \n")
-			if s1 != "" {
-				out += s + "."
+	var out string
+	var paragraph int
+	for _, r := range ranges {
+		for _, s := range sentances[r[0]:r[1]] {
+			switch {
+			case out == "":
+			case s.paragraph != paragraph:
+				// blocks and paragraphs are separated by a blank line
+				out += "\n\n"
+			default:
+				out += " "
 			}
+			out += s.text
+			paragraph = s.paragraph
+		}
+	}
+	return out, nil
+}
+
+func extractParagraphs(full string, sections string, comment string) (string, error) {
+	return extractBlockParagraphs(full, sections, parseBlocks(comment, false), docRenderer{format: Markdown})
+}
+
+// extractBlockParagraphs selects paragraphs, the spans of blocks of a parsed
+// doc comment separated by blank lines, using the same section syntax as
+// extractBlockSections. Selected paragraphs are separated by a blank line.
+func extractBlockParagraphs(full string, sections string, blocks []docBlock, r docRenderer) (string, error) {
+	var paragraphs [][]docBlock
+	for _, b := range blocks {
+		if n := len(paragraphs); n > 0 && !b.blank {
+			paragraphs[n-1] = append(paragraphs[n-1], b)
+			continue
+		}
+		b.blank = false
+		paragraphs = append(paragraphs, []docBlock{b})
+	}
+
+	ranges, err := sectionRanges(full, sections, len(paragraphs))
+	if err != nil {
+		return "", err
+	}
+
+	var out []string
+	for _, span := range ranges {
+		for _, p := range paragraphs[span[0]:span[1]] {
+			out = append(out, r.renderBlocks(p))
+		}
+	}
+	return strings.Join(out, "\n\n"), nil
+}
+
+// extractWords selects words (whitespace delimited tokens) from comment using
+// the same section syntax as extractSections.
+func extractWords(full string, sections string, comment string) (string, error) {
+	words := strings.Fields(comment)
+	ranges, err := sectionRanges(full, sections, len(words))
+	if err != nil {
+		return "", err
+	}
+	var out []string
+	for _, r := range ranges {
+		out = append(out, words[r[0]:r[1]]...)
+	}
+	return strings.Join(out, " "), nil
+}
+
+// urlRegex matches http and https URLs. Trailing punctuation is not part of
+// the URL, see urlSpans.
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// urlSpans returns the [start, end) byte offsets of the URLs in s. Trailing
+// punctuation (e.g. the period ending a sentance) is excluded.
+func urlSpans(s string) [][2]int {
+	var out [][2]int
+	for _, loc := range urlRegex.FindAllStringIndex(s, -1) {
+		end := loc[0] + len(strings.TrimRight(s[loc[0]:loc[1]], ".,;:!?)]'"))
+		out = append(out, [2]int{loc[0], end})
+	}
+	return out
+}
+
+// linkify wraps the bare URLs in s as markdown autolinks, or anchors in HTML.
+// URLs that are already autolinks or the target of a markdown link are left
+// alone.
+func linkify(s string, f Format) string {
+	var out string
+	var last int
+	for _, span := range urlSpans(s) {
+		if span[0] > 0 && (s[span[0]-1] == '<' || s[span[0]-1] == '(') {
+			continue
+		}
+		u := s[span[0]:span[1]]
+		if f == HTML {
+			out += s[last:span[0]] + `<a href="` + u + `">` + u + "</a>"
+		} else {
+			out += s[last:span[0]] + "<" + u + ">"
+		}
+		last = span[1]
+	}
+	return out + s[last:]
+}
+
+// abbreviations lists the words (lower case, without the final period) that
+// never end a sentence, even when followed by whitespace.
+var abbreviations = map[string]bool{
+	"e.g": true,
+	"i.e": true,
+	"vs":  true,
+	"mr":  true,
+	"mrs": true,
+	"dr":  true,
+}
+
+// splitSentences splits comment into sentences terminated by ".", "?" or "!".
+// A terminator only ends a sentence when it is followed by whitespace or the
+// end of the string, and periods ending an abbreviation (see abbreviations) or
+// a single capital initial are skipped. "etc." ends a sentence only when the
+// next word is capitalized. URLs are never split. Each sentence keeps its
+// terminator and any leading whitespace, so joining the results gives back the
+// original comment.
+func splitSentences(comment string) []string {
+	var out []string
+	start := 0
+	urls := urlSpans(comment)
+	for i := 0; i < len(comment); i++ {
+		if len(urls) > 0 && i >= urls[0][0] {
+			// never split inside a URL
+			i = urls[0][1] - 1
+			urls = urls[1:]
+			continue
 		}
+		if !strings.ContainsRune(".?!", rune(comment[i])) || !isSentenceEnd(comment, i) {
+			continue
+		}
+		out = append(out, comment[start:i+1])
+		start = i + 1
+	}
+	return append(out, comment[start:])
+}
+
+// isSentenceEnd reports whether the terminator at comment[i] ends a sentence.
+func isSentenceEnd(comment string, i int) bool {
+	rest := comment[i+1:]
+	if rest != "" && !unicode.IsSpace(rune(rest[0])) {
+		return false
+	}
+	if comment[i] != '.' {
+		return true
+	}
+	word := comment[:i]
+	if j := strings.LastIndexFunc(word, unicode.IsSpace); j > -1 {
+		word = word[j+1:]
+	}
+	word = strings.TrimLeft(word, "(\"'")
+	switch {
+	case strings.TrimSpace(rest) == "":
+		return true
+	case len(word) == 1 && unicode.IsUpper(rune(word[0])):
+		// single capital initial, e.g. "J. R. R. Tolkien"
+		return false
+	case abbreviations[strings.ToLower(word)]:
+		return false
+	case strings.ToLower(word) == "etc":
+		next := strings.TrimLeftFunc(rest, unicode.IsSpace)
+		return unicode.IsUpper(rune(next[0]))
 	}
-	return strings.Trim(out, " ")
+	return true
 }
 
 func (m *CodeMap) scanTests(name string, p *ast.Package) error {
@@ -214,69 +2098,202 @@ func (m *CodeMap) scanTests(name string, p *ast.Package) error {
 		}
 		examples := doc.Examples(f)
 		for _, ex := range examples {
+			if ok, err := m.includeExample("Example" + ex.Name); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
 			m.Examples["Example"+ex.Name] = ex
+			if c := exampleDoc(ex); m.exampleDocs && c != "" {
+				m.Comments[exampleDocName(ex.Name)] = c
+			}
 		}
 	}
 	return nil
 }
 
+// includeExample reports whether the example named name is scanned, see
+// WithExampleInclude and WithExampleExclude.
+func (m *CodeMap) includeExample(name string) (bool, error) {
+	match := func(patterns []string) (bool, error) {
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return false, fmt.Errorf("invalid example pattern %s: %v", pattern, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if len(m.exampleInclude) > 0 {
+		if ok, err := match(m.exampleInclude); !ok || err != nil {
+			return false, err
+		}
+	}
+	excluded, err := match(m.exampleExclude)
+	return !excluded, err
+}
+
+// exampleDoc returns the doc comment of an example function, without any
+// trailing output comment.
+func exampleDoc(e *doc.Example) string {
+	lines := strings.SplitAfter(e.Doc, "\n")
+	for i, l := range lines {
+		if outputRegex.MatchString(l) {
+			lines = lines[:i]
+			break
+		}
+	}
+	c := strings.TrimSpace(strings.Join(lines, ""))
+	if c == "" {
+		return ""
+	}
+	return c + "\n"
+}
+
+// exampleDocName returns the key in Comments of the doc of the named example,
+// e.g. "Example.Conn.Close_timeout" for "Conn_Close_timeout".
+func exampleDocName(name string) string {
+	ident, suffix := splitExampleName(name)
+	out := "Example"
+	if ident != "" {
+		out += "." + ident
+	}
+	if suffix != "" {
+		out += "_" + suffix
+	}
+	return out
+}
+
 func (m *CodeMap) scanPkg(name string, p *ast.Package) error {
 	for fpath, f := range p.Files {
-		if f.Doc.Text() != "" {
+		m.files = append(m.files, f)
+		if c := fileDoc(f); c != "" {
 			_, name := filepath.Split(fpath)
-			m.Comments[strings.Replace(name, ".", "_", -1)] = f.Doc.Text()
+			m.Comments[strings.Replace(name, ".", "_", -1)] = c
 		}
 		for _, d := range f.Decls {
 			switch d := d.(type) {
 			case *ast.FuncDecl:
-				if d.Doc.Text() == "" {
+				if !m.include(d.Name) {
 					continue
 				}
+				var name string
 				if d.Recv == nil {
 					// function
-					//fmt.Println(d.Name, d.Doc.Text())
-					name := fmt.Sprint(d.Name)
-					m.Comments[name] = d.Doc.Text()
+					name = fmt.Sprint(d.Name)
 				} else {
-					// method
-					e := d.Recv.List[0].Type
-					if se, ok := e.(*ast.StarExpr); ok {
-						// if the method receiver has a *, discard it.
-						e = se.X
+					// method: discard any * and type parameters from the
+					// receiver, so "(t *Tree[K, V])" gives "Tree".
+					recv := baseTypeName(d.Recv.List[0].Type)
+					if recv == nil || !m.include(recv) {
+						continue
+					}
+					name = fmt.Sprintf("%s.%s", recv, d.Name)
+					if prev, ok := m.Decls[name].(*ast.FuncDecl); ok && prev.Recv != nil && isPointerRecv(prev) != isPointerRecv(d) {
+						// e.g. in files with build tags that are never
+						// built together: keep the pointer method as
+						// "(*T).M" rather than overwriting.
+						value, pointer := prev, d
+						if isPointerRecv(prev) {
+							value, pointer = d, prev
+						}
+						ptrName := fmt.Sprintf("(*%s).%s", recv, d.Name)
+						m.Errors = append(m.Errors, fmt.Errorf("%s: %s has both value and pointer receivers, the pointer method is %s", m.fset.Position(d.Pos()), name, ptrName))
+						m.Decls[ptrName] = pointer
+						if c := commentText(pointer.Doc); c != "" {
+							m.Comments[ptrName] = c
+						}
+						delete(m.Comments, name)
+						d = value
 					}
-					b := &bytes.Buffer{}
-					printer.Fprint(b, m.fset, e)
-					//fmt.Printf("%s.%s %s", b.String(), d.Name, d.Doc.Text())
-					name := fmt.Sprintf("%s.%s", b.String(), d.Name)
-					m.Comments[name] = d.Doc.Text()
+				}
+				m.Decls[name] = d
+				if c := commentText(d.Doc); c != "" {
+					m.Comments[name] = c
 				}
 			case *ast.GenDecl:
-				switch s := d.Specs[0].(type) {
-				case *ast.TypeSpec:
-					//fmt.Println(s.Name, d.Doc.Text())
-					name := fmt.Sprint(s.Name)
-					m.Comments[name] = d.Doc.Text()
-					if t, ok := s.Type.(*ast.StructType); ok {
-						for _, f := range t.Fields.List {
-							if f.Doc.Text() == "" {
+				for _, s := range d.Specs {
+					switch s := s.(type) {
+					case *ast.TypeSpec:
+						if !m.include(s.Name) {
+							continue
+						}
+						name := fmt.Sprint(s.Name)
+						if c := specDoc(d, s.Doc, s.Comment); c != "" {
+							m.Comments[name] = c
+						}
+						if len(d.Specs) == 1 {
+							m.Decls[name] = d
+						} else {
+							// a type in a grouped declaration is rendered alone
+							c := *s
+							c.Doc = nil
+							m.Decls[name] = &ast.GenDecl{Tok: d.Tok, TokPos: s.Pos(), Specs: []ast.Spec{&c}}
+						}
+						switch t := s.Type.(type) {
+						case *ast.StructType:
+							for _, f := range t.Fields.List {
+								doc := commentText(f.Doc)
+								if doc == "" {
+									continue
+								}
+								// grouped fields (e.g. "X, Y int") share the doc, and
+								// embedded fields are named after their type.
+								names := f.Names
+								if len(names) == 0 {
+									if id := baseTypeName(f.Type); id != nil {
+										names = []*ast.Ident{id}
+									}
+								}
+								for _, n := range names {
+									if n.IsExported() {
+										fieldName := fmt.Sprint(name, ".", n)
+										m.Comments[fieldName] = doc
+									}
+								}
+							}
+						case *ast.InterfaceType:
+							for _, f := range t.Methods.List {
+								// embedded interfaces are named after their type
+								names := f.Names
+								if len(names) == 0 {
+									if id := baseTypeName(f.Type); id != nil {
+										names = []*ast.Ident{id}
+									}
+								}
+								for _, n := range names {
+									if !n.IsExported() {
+										continue
+									}
+									methodName := fmt.Sprint(name, ".", n)
+									m.Decls[methodName] = f
+									if c := commentText(f.Doc); c != "" {
+										m.Comments[methodName] = c
+									} else if c := commentText(f.Comment); c != "" {
+										m.Comments[methodName] = c
+									}
+								}
+							}
+						}
+					case *ast.ValueSpec:
+						// each name in "var a, b int" shares the doc
+						c := specDoc(d, s.Doc, s.Comment)
+						for _, n := range s.Names {
+							if n.Name == "_" || !m.include(n) {
 								continue
 							}
-							if f.Names[0].IsExported() {
-								fieldName := fmt.Sprint(name, ".", f.Names[0])
-								m.Comments[fieldName] = f.Doc.Text()
+							name := fmt.Sprint(n)
+							// consts and vars are rendered with the rest of
+							// their group.
+							m.Decls[name] = d
+							if c != "" {
+								m.Comments[name] = c
 							}
 						}
 					}
-				case *ast.ValueSpec:
-					if d.Doc.Text() == "" {
-						continue
-					}
-					//fmt.Println(s.Names[0], d.Doc.Text())
-					if len(s.Names) == 0 {
-						continue
-					}
-					name := fmt.Sprint(s.Names[0])
-					m.Comments[name] = d.Doc.Text()
 				}
 			}
 		}
@@ -284,14 +2301,312 @@ func (m *CodeMap) scanPkg(name string, p *ast.Package) error {
 	return nil
 }
 
+// include reports whether the declaration named id is scanned: if
+// m.ExportedOnly is set, unexported declarations are skipped.
+func (m *CodeMap) include(id *ast.Ident) bool {
+	return !m.ExportedOnly || id.IsExported()
+}
+
+// isPointerRecv reports whether the method d has a pointer receiver.
+func isPointerRecv(d *ast.FuncDecl) bool {
+	t := d.Recv.List[0].Type
+	if p, ok := t.(*ast.ParenExpr); ok {
+		t = p.X
+	}
+	_, ok := t.(*ast.StarExpr)
+	return ok
+}
+
+// baseTypeName returns the identifier of the named type in e, discarding any
+// pointer, package qualifier or type arguments, e.g. "Reader" for "*io.Reader".
+// It returns nil if e is not a named type.
+func baseTypeName(e ast.Expr) *ast.Ident {
+	for {
+		switch t := e.(type) {
+		case *ast.Ident:
+			return t
+		case *ast.StarExpr:
+			e = t.X
+		case *ast.SelectorExpr:
+			e = t.Sel
+		case *ast.IndexExpr:
+			e = t.X
+		case *ast.IndexListExpr:
+			e = t.X
+		case *ast.ParenExpr:
+			e = t.X
+		default:
+			return nil
+		}
+	}
+}
+
+// commentText returns the text of a doc comment like CommentGroup.Text, which
+// removes directives such as "//go:generate", but also removes "//nolint"
+// comments.
+func commentText(c *ast.CommentGroup) string {
+	if c == nil {
+		return ""
+	}
+	var list []*ast.Comment
+	for _, line := range c.List {
+		if !nolintRegex.MatchString(line.Text) {
+			list = append(list, line)
+		}
+	}
+	return (&ast.CommentGroup{List: list}).Text()
+}
+
+// nolintRegex matches a golangci-lint directive, which unlike others may not
+// have a colon.
+var nolintRegex = regexp.MustCompile(`^//nolint(:\S*)?\s*$`)
+
+// specDoc returns the documentation for a spec in a GenDecl: the doc comment
+// above the spec, the line comment after it, or failing that, the doc comment
+// of the whole declaration.
+func specDoc(d *ast.GenDecl, above, line *ast.CommentGroup) string {
+	if c := commentText(above); c != "" {
+		return c
+	}
+	if c := commentText(line); c != "" {
+		return c
+	}
+	return commentText(d.Doc)
+}
+
+func (m *CodeMap) scanNotes(name string, p *ast.Package) error {
+	// PreserveAST stops doc.New from stripping function bodies, which the
+	// examples still need.
+	d := doc.New(p, m.pkg, doc.AllDecls|doc.PreserveAST)
+	for marker, notes := range d.Notes {
+		m.Notes[marker] = append(m.Notes[marker], notes...)
+	}
+	m.scanMarkers(p)
+	if strings.HasSuffix(name, "_test") {
+		return nil
+	}
+	// as in go/doc, the package comments of the files are joined in file name
+	// order
+	var fpaths []string
+	for fpath := range p.Files {
+		if !strings.HasSuffix(fpath, "_test.go") {
+			fpaths = append(fpaths, fpath)
+		}
+	}
+	sort.Strings(fpaths)
+	var docs []string
+	for _, fpath := range fpaths {
+		c := fileDoc(p.Files[fpath])
+		if c == "" {
+			continue
+		}
+		if filepath.Base(fpath) == "doc.go" {
+			docs = []string{c}
+			break
+		}
+		docs = append(docs, c)
+	}
+	m.packageDoc = strings.Join(docs, "\n")
+	return nil
+}
+
+// fileDoc returns the package comment of f, without any license header or
+// build constraint at the start of the comment.
+func fileDoc(f *ast.File) string {
+	paragraphs := strings.SplitAfter(commentText(f.Doc), "\n\n")
+	for len(paragraphs) > 0 && headerRegex.MatchString(paragraphs[0]) {
+		paragraphs = paragraphs[1:]
+	}
+	return strings.Join(paragraphs, "")
+}
+
+// headerRegex matches a paragraph at the start of a file that isn't
+// documentation, e.g. "Copyright 2020 ..." or "+build linux".
+var headerRegex = regexp.MustCompile(`^(Copyright|\(c\)|©|\+build |SPDX-License-Identifier:|Licensed under|Code generated )`)
+
+// scanMarkers adds the notes with the markers from WithNoteMarkers that have
+// no uid, e.g. "PERF: ...", which go/doc doesn't recognise. A note ends at a
+// blank line, the end of the comment or the start of another note.
+func (m *CodeMap) scanMarkers(p *ast.Package) {
+	if len(m.noteMarkers) == 0 {
+		return
+	}
+	quoted := make([]string, len(m.noteMarkers))
+	for i, marker := range m.noteMarkers {
+		quoted[i] = regexp.QuoteMeta(marker)
+	}
+	markerRegex := regexp.MustCompile(`^(` + strings.Join(quoted, "|") + `):\s*`)
+	var fpaths []string
+	for fpath := range p.Files {
+		fpaths = append(fpaths, fpath)
+	}
+	sort.Strings(fpaths)
+	for _, fpath := range fpaths {
+		for _, c := range p.Files[fpath].Comments {
+			var note *doc.Note
+			var marker string
+			for _, line := range strings.Split(c.Text(), "\n") {
+				if match := markerRegex.FindStringSubmatch(line); match != nil {
+					if note != nil {
+						m.Notes[marker] = append(m.Notes[marker], note)
+					}
+					marker = match[1]
+					note = &doc.Note{Pos: c.Pos(), End: c.End(), Body: line[len(match[0]):] + "\n"}
+				} else if note != nil && (noteRegex.MatchString(line) || strings.TrimSpace(line) == "") {
+					// another note, or the end of the paragraph
+					m.Notes[marker] = append(m.Notes[marker], note)
+					note = nil
+				} else if note != nil {
+					note.Body += line + "\n"
+				}
+			}
+			if note != nil {
+				m.Notes[marker] = append(m.Notes[marker], note)
+			}
+		}
+	}
+}
+
+// noteRegex matches the start of a note recognised by go/doc.
+var noteRegex = regexp.MustCompile(`^[A-Z][A-Z]+\([^)]+\):?`)
+
+// parseDir parses the Go files in m.root. Files that fail to parse are skipped
+// and the errors recorded in m.Errors, so one broken file doesn't stop the
+// rest of the package being documented. Files are parsed concurrently by up
+// to m.workers goroutines, but the results are merged in file name order.
+func (m *CodeMap) parseDir() (map[string]*ast.Package, error) {
+	entries, err := fs.ReadDir(m.fsys, m.root)
+	if err != nil {
+		return nil, err
+	}
+	type job struct {
+		name, filename string
+		info           fs.FileInfo
+		file           *ast.File
+		err, readErr   error
+	}
+	var jobs []*job
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if m.filter != nil && !m.filter(info) {
+			continue
+		}
+		if ok, err := m.matchFile(e.Name()); err != nil {
+			m.Errors = append(m.Errors, err)
+			continue
+		} else if !ok {
+			continue
+		}
+		jobs = append(jobs, &job{name: e.Name(), filename: filepath.Join(m.dir, e.Name()), info: info})
+	}
+
+	workers := m.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				// the FileSet is safe for concurrent use
+				j.file, j.err = m.parseFile(j.filename, j.info, func() ([]byte, error) {
+					src, err := m.readSource(j.name)
+					j.readErr = err
+					return src, err
+				})
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	pkgs := map[string]*ast.Package{}
+	for _, j := range jobs {
+		if j.readErr != nil {
+			return nil, j.readErr
+		}
+		if j.err != nil {
+			m.Errors = append(m.Errors, j.err)
+			continue
+		}
+		p, ok := pkgs[j.file.Name.Name]
+		if !ok {
+			p = &ast.Package{Name: j.file.Name.Name, Files: map[string]*ast.File{}}
+			pkgs[j.file.Name.Name] = p
+		}
+		p.Files[j.filename] = j.file
+	}
+	if len(pkgs) == 0 && len(m.Errors) > 0 {
+		// nothing to document
+		return nil, m.Errors[0]
+	}
+	return pkgs, nil
+}
+
+// readSource reads the named Go file in m.root. Windows line endings are
+// converted, so positions in the parsed file and the code and comments the
+// helpers print only use "\n".
+func (m *CodeMap) readSource(name string) ([]byte, error) {
+	src, err := fs.ReadFile(m.fsys, path.Join(m.root, name))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n")), nil
+}
+
+// matchFile reports whether the file in m.root is built for m.GOOS and
+// m.GOARCH. Cgo files are included.
+func (m *CodeMap) matchFile(name string) (bool, error) {
+	ctx := build.Default
+	if m.GOOS != "" {
+		ctx.GOOS = m.GOOS
+	}
+	if m.GOARCH != "" {
+		ctx.GOARCH = m.GOARCH
+	}
+	ctx.CgoEnabled = true
+	ctx.JoinPath = path.Join
+	ctx.OpenFile = func(name string) (io.ReadCloser, error) {
+		return m.fsys.Open(name)
+	}
+	ok, err := ctx.MatchFile(m.root, name)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", filepath.Join(m.dir, name), err)
+	}
+	return ok, nil
+}
+
 func (m *CodeMap) scanDir() error {
 	// Create the AST by parsing src.
-	m.fset = token.NewFileSet() // positions are relative to fset
-	pkgs, err := parser.ParseDir(m.fset, m.dir, nil, parser.ParseComments)
+	if m.fset == nil {
+		m.fset = token.NewFileSet() // positions are relative to fset
+	}
+	pkgs, err := m.parseDir()
 	if err != nil {
 		return err
 	}
-	for name, p := range pkgs {
+	var names []string
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := pkgs[name]
 		m.Name = strings.TrimSuffix(name, "_test")
 		if err := m.scanTests(name, p); err != nil {
 			return err
@@ -299,6 +2614,12 @@ func (m *CodeMap) scanDir() error {
 		if err := m.scanPkg(name, p); err != nil {
 			return err
 		}
+		if err := m.scanNotes(name, p); err != nil {
+			return err
+		}
+		if err := m.scanSnippets(name, p); err != nil {
+			return err
+		}
 	}
 
 	return nil
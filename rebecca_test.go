@@ -1,8 +1,14 @@
 package rebecca
 
 import (
+	"go/ast"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestExtractSections(t *testing.T) {
@@ -55,11 +61,2327 @@ func TestExtractSections(t *testing.T) {
 			sections: ":4",
 			expected: "foo. bar. baz. qux.",
 		},
+		{
+			sections: "-1",
+			expected: "quz.",
+		},
+		{
+			sections: "-2:",
+			expected: "qux. quz.",
+		},
+		{
+			sections: "-3:-1",
+			expected: "baz. qux.",
+		},
+		{
+			sections: ":-3",
+			expected: "foo. bar.",
+		},
+		{
+			sections: "-0",
+			expected: "foo.",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractSections("Spec["+test.sections+"]", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExtractSectionsAbbreviations(t *testing.T) {
+	tests := []struct {
+		comment  string
+		sections string
+		expected string
+	}{
+		{
+			comment:  "Use this, e.g. for configuration. It returns nil.",
+			sections: "0",
+			expected: "Use this, e.g. for configuration.",
+		},
+		{
+			comment:  "Use this, e.g. for configuration. It returns nil.",
+			sections: "1",
+			expected: "It returns nil.",
+		},
+		{
+			comment:  "Pass a value, i.e. a string. Done.",
+			sections: "0",
+			expected: "Pass a value, i.e. a string.",
+		},
+		{
+			comment:  "Compare a vs. b. Done.",
+			sections: "0",
+			expected: "Compare a vs. b.",
+		},
+		{
+			comment:  "Written by Mr. Smith and J. R. Hartley. Done.",
+			sections: "0",
+			expected: "Written by Mr. Smith and J. R. Hartley.",
+		},
+		{
+			comment:  "Supports foo, bar etc. Done.",
+			sections: "0",
+			expected: "Supports foo, bar etc.",
+		},
+		{
+			comment:  "Supports foo, bar etc. and more. Done.",
+			sections: "1",
+			expected: "Done.",
+		},
+		{
+			comment:  "Calls fmt.Println. Done.",
+			sections: "0",
+			expected: "Calls fmt.Println.",
+		},
+		{
+			comment:  "One. Two.\n\nThree. Four.",
+			sections: "1:3",
+			expected: "Two.\n\nThree.",
+		},
+		{
+			comment:  "One. Two.\n\nThree. Four.",
+			sections: "0,3",
+			expected: "One.\n\nFour.",
+		},
+		{
+			comment:  "One\ntwo. Three.\n\nFour.",
+			sections: "0:2",
+			expected: "One\ntwo. Three.",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractSections("Spec["+test.sections+"]", test.sections, test.comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("Comment: %s. SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.comment), strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExtractSectionsTerminators(t *testing.T) {
+	comment := "Want speed? Use the cached path. Done!"
+	tests := []struct {
+		sections string
+		expected string
+	}{
+		{
+			sections: "0",
+			expected: "Want speed?",
+		},
+		{
+			sections: "1",
+			expected: "Use the cached path.",
+		},
+		{
+			sections: "2",
+			expected: "Done!",
+		},
+		{
+			sections: "0,2",
+			expected: "Want speed? Done!",
+		},
+		{
+			sections: "1:",
+			expected: "Use the cached path. Done!",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractSections("Spec["+test.sections+"]", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExtractWords(t *testing.T) {
+	comment := "Foo does a thing.\nIt also does\tanother thing."
+	tests := []struct {
+		sections string
+		expected string
+	}{
+		{
+			sections: "0",
+			expected: "Foo",
+		},
+		{
+			sections: "0:4",
+			expected: "Foo does a thing.",
+		},
+		{
+			sections: "4:",
+			expected: "It also does another thing.",
+		},
+		{
+			sections: ":3",
+			expected: "Foo does a",
+		},
+		{
+			sections: "0,5",
+			expected: "Foo also",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractWords("Spec{"+test.sections+"}", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExtractParagraphs(t *testing.T) {
+	comment := "Foo does a thing.\nOn two lines.\n\nIt also does another thing.\n\n\tfoo()\n\n\tbar()\n\nLast."
+	tests := []struct {
+		sections string
+		expected string
+	}{
+		{
+			sections: "0",
+			expected: "Foo does a thing.\nOn two lines.",
+		},
+		{
+			sections: "1",
+			expected: "It also does another thing.",
+		},
+		{
+			sections: "2",
+			expected: "```\nfoo()\n\nbar()\n```",
+		},
+		{
+			sections: "-1",
+			expected: "Last.",
+		},
+		{
+			sections: "1:",
+			expected: "It also does another thing.\n\n```\nfoo()\n\nbar()\n```\n\nLast.",
+		},
+		{
+			sections: "0,3",
+			expected: "Foo does a thing.\nOn two lines.\n\nLast.",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractParagraphs("Spec¶["+test.sections+"]", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	for _, sections := range []string{"4", "-5", "x"} {
+		if _, err := extractParagraphs("Spec¶["+sections+"]", sections, comment); err == nil || !strings.Contains(err.Error(), "Spec¶["+sections+"]") {
+			t.Fatalf("SectionSpec: %s. Expected an error naming the spec. Found %v.", strconv.Quote(sections), err)
+		}
+	}
+}
+
+func TestExtractSectionsOutOfRange(t *testing.T) {
+	comment := "foo. bar. baz."
+	for _, sections := range []string{"3", "-4", "-99", "-99:", ":-99", "x"} {
+		_, err := extractSections("Spec["+sections+"]", sections, comment)
+		if err == nil {
+			t.Fatalf("SectionSpec: %s. Expected error.", strconv.Quote(sections))
+		} else if !strings.Contains(err.Error(), "Spec["+sections+"]") {
+			t.Fatalf("SectionSpec: %s. Error should name the spec. Found %s.", strconv.Quote(sections), err)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Doc("Foo.Bar"); err == nil || err.Error() != "doc for Foo.Bar not found" {
+		t.Fatalf("Expected doc not found error. Found %v.", err)
+	}
+	if _, err := m.Doc("Bar[0]"); err == nil || err.Error() != "doc for Bar not found in Bar[0]" {
+		t.Fatalf("Expected doc not found error. Found %v.", err)
+	}
+	if _, err := m.Doc("foo"); err == nil || err.Error() != "doc for foo not found, did you mean Foo?" {
+		t.Fatalf("Expected a suggestion. Found %v.", err)
+	}
+	if _, err := m.Example("ExampleFo", false); err == nil || err.Error() != "example ExampleFo not found, did you mean ExampleFoo?" {
+		t.Fatalf("Expected a suggestion. Found %v.", err)
+	}
+	if _, err := m.Example("ExampleBar", false); err == nil || err.Error() != "example ExampleBar not found" {
+		t.Fatalf("Expected example not found error. Found %v.", err)
+	}
+	if _, err := m.Output("ExampleBar"); err == nil || err.Error() != "example ExampleBar not found" {
+		t.Fatalf("Expected example not found error. Found %v.", err)
+	}
+	if _, err := m.Playground("ExampleBar"); err == nil || err.Error() != "example ExampleBar not found" {
+		t.Fatalf("Expected example not found error. Found %v.", err)
+	}
+}
+
+// newTestCodeMap writes files to a temporary directory and scans it.
+func newTestCodeMap(t *testing.T, files map[string]string) *CodeMap {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewCodeMap("example.com/foo", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSynopsis(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things (like this and that). It is
+// great.
+func Foo() {}
+
+// Bar spans
+// two lines. Second sentance.
+type Bar struct{}
+`,
+	})
+	tests := map[string]string{
+		"Foo": "Foo does things (like this and that).",
+		"Bar": "Bar spans two lines.",
+	}
+	for name, expected := range tests {
+		found, err := m.Synopsis(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Synopsis("Baz"); err == nil {
+		t.Fatal("Expected error for unknown name.")
+	}
+}
+
+func TestExtractSectionsURLs(t *testing.T) {
+	comment := "See https://example.com/v1.2?a=b for details. Or http://example.com/x. Done."
+	tests := []struct {
+		sections string
+		expected string
+	}{
+		{
+			sections: "0",
+			expected: "See https://example.com/v1.2?a=b for details.",
+		},
+		{
+			sections: "1",
+			expected: "Or http://example.com/x.",
+		},
+		{
+			sections: "2",
+			expected: "Done.",
+		},
+	}
+	for _, test := range tests {
+		found, err := extractSections("Spec["+test.sections+"]", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
+		if found != test.expected {
+			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestLinkify(t *testing.T) {
+	tests := map[string]string{
+		"See https://example.com/v1.2 for details.": "See <https://example.com/v1.2> for details.",
+		"Or http://example.com.":                    "Or <http://example.com>.",
+		"Already <https://example.com>.":            "Already <https://example.com>.",
+		"A [link](https://example.com).":            "A [link](https://example.com).",
+		"No links here.":                            "No links here.",
+	}
+	for in, expected := range tests {
+		if found := linkify(in, Markdown); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", strconv.Quote(in), strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestDocCodeBlocks(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things. Use it like this:
+//
+//	x := Foo()
+//	if x {
+//		fmt.Println("yes.")
+//	}
+//
+// It returns true. Lists are not code:
+//
+//   - one
+//   - two
+func Foo() bool { return true }
+`,
+	})
+	tests := map[string]string{
+		"Foo":      "Foo does things. Use it like this:\n\n```\nx := Foo()\nif x {\n\tfmt.Println(\"yes.\")\n}\n```\n\nIt returns true. Lists are not code:\n\n  - one\n  - two",
+		"Foo[1]":   "Use it like this:",
+		"Foo[1:3]": "Use it like this:\n\n```\nx := Foo()\nif x {\n\tfmt.Println(\"yes.\")\n}\n```",
+		"Foo[2:4]": "```\nx := Foo()\nif x {\n\tfmt.Println(\"yes.\")\n}\n```\n\nIt returns true.",
+		"Foo[3]":   "It returns true.",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExtractSectionsJoin(t *testing.T) {
+	comment := "One.  Two.\nThree!\n"
+	tests := []struct {
+		sections string
+		expected string
+	}{
+		{
+			sections: "0:1",
+			expected: "One.",
+		},
+		{
+			sections: "1:2",
+			expected: "Two.",
+		},
+		{
+			sections: "1:",
+			expected: "Two. Three!",
+		},
+		{
+			sections: "2,0",
+			expected: "Three! One.",
+		},
 	}
 	for _, test := range tests {
-		found := extractSections("Spec["+test.sections+"]", test.sections, comment)
+		found, err := extractSections("Spec["+test.sections+"]", test.sections, comment)
+		if err != nil {
+			t.Fatalf("SectionSpec: %s. Unexpected error: %v.", strconv.Quote(test.sections), err)
+		}
 		if found != test.expected {
 			t.Fatalf("SectionSpec: %s. Expected %s. Found %s.", strconv.Quote(test.sections), strconv.Quote(test.expected), strconv.Quote(found))
 		}
 	}
 }
+
+func TestDocMarkdown(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things. It has options:
+//   - one, which
+//     wraps.
+//   - two
+//
+// # Usage
+//
+// Call it. Then:
+//
+//  1. wait
+//  2. profit
+//
+// Old Style Heading
+//
+// Done.
+func Foo() {}
+`,
+	})
+	verbatim := "Foo does things. It has options:\n  - one, which\n    wraps.\n  - two\n\n# Usage\n\nCall it. Then:\n\n 1. wait\n 2. profit\n\nOld Style Heading\n\nDone."
+	if found, err := m.Doc("Foo"); err != nil {
+		t.Fatal(err)
+	} else if found != verbatim {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(verbatim), strconv.Quote(found))
+	}
+	m.RenderMarkdown = true
+	tests := map[string]string{
+		"Foo":      "Foo does things. It has options:\n- one, which wraps.\n- two\n\n### Usage\n\nCall it. Then:\n\n1. wait\n2. profit\n\n### Old Style Heading\n\nDone.",
+		"Foo[1:4]": "It has options:\n\n- one, which wraps.\n- two\n\n### Usage",
+		"Foo[6]":   "1. wait\n2. profit",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestCommentToMarkdown(t *testing.T) {
+	tests := []struct {
+		name, text, pkg, expected string
+	}{
+		{"prose", "Foo does things.\nOn two lines.\n", "", "Foo does things.\nOn two lines."},
+		{"paragraphs", "One.\n\nTwo.\n", "", "One.\n\nTwo."},
+		{"code", "Call it:\n\n\tx := Foo()\n\tx.Bar()\n", "", "Call it:\n\n```\nx := Foo()\nx.Bar()\n```"},
+		{"list", "Options:\n  - one, which\n    wraps.\n  - two\n", "", "Options:\n- one, which wraps.\n- two"},
+		{"numbered list", "Steps:\n\n 1. wait\n 2. profit\n", "", "Steps:\n\n1. wait\n2. profit"},
+		{"heading", "# Usage\n\nCall it.\n", "", "### Usage\n\nCall it."},
+		{"old style heading", "Intro.\n\nOld Style Heading\n\nDone.\n", "", "Intro.\n\n### Old Style Heading\n\nDone."},
+		{"local doc link", "See [Conn.Close] and [*Conn].\n", "example.com/foo", "See [Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close) and [*Conn](https://pkg.go.dev/example.com/foo#Conn)."},
+		{"local doc link without package", "See [Conn.Close].\n", "", "See [Conn.Close]."},
+		{"import doc link", "Wraps an [io.Reader], see [encoding/json].\n", "", "Wraps an [io.Reader](https://pkg.go.dev/io#Reader), see [encoding/json](https://pkg.go.dev/encoding/json)."},
+		{"not a doc link", "Uses a[i] and [lower].\n", "example.com/foo", "Uses a[i] and [lower]."},
+	}
+	for _, test := range tests {
+		if found := CommentToMarkdown(test.text, test.pkg); found != test.expected {
+			t.Fatalf("Test: %s. Expected %s. Found %s.", test.name, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+
+	// DocFunc with RenderMarkdown converts a doc comment the same way
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Conn is a connection.
+type Conn struct{}
+
+// Close closes.
+func (c *Conn) Close() {}
+
+// Foo does things, see [Conn.Close] and [io.Reader].
+//
+// # Usage
+//
+// Options:
+//   - one
+//   - two
+//
+//	x := Foo()
+func Foo() {}
+`,
+	})
+	m.RenderMarkdown = true
+	text := "Foo does things, see [Conn.Close] and [io.Reader].\n\n# Usage\n\nOptions:\n  - one\n  - two\n\n\tx := Foo()\n"
+	expected := CommentToMarkdown(text, "example.com/foo")
+	if found := m.DocFunc("Foo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestNotes(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// BUG(dave): Foo is slow
+// on large inputs.
+
+// Foo does things.
+//
+// TODO(jarreds): make it faster.
+func Foo() {}
+
+// BUG(jarreds): Bar is broken.
+func Bar() {}
+`,
+	})
+	expected := "- dave: Foo is slow on large inputs.\n- jarreds: Bar is broken."
+	if found := m.NotesFunc("BUG"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	expected = "- jarreds: make it faster."
+	if found := m.NotesFunc("TODO"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if found := m.NotesFunc("SECURITY"); found != "" {
+		t.Fatalf("Expected empty string. Found %s.", strconv.Quote(found))
+	}
+}
+
+func TestFieldDocs(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+import "io"
+
+// T is a type.
+type T struct {
+	// coordinates
+	X, Y int
+	// embedded
+	io.Reader
+	// embedded pointer
+	*U
+	// embedded qualified pointer
+	*io.PipeWriter
+	// lower case
+	z, W int
+}
+
+// U is a type.
+type U struct{}
+`,
+	})
+	for _, name := range []string{"T.X", "T.Y", "T.W", "T.Reader", "T.U", "T.PipeWriter"} {
+		if _, ok := m.Comments[name]; !ok {
+			t.Fatalf("Expected doc for %s.", name)
+		}
+	}
+	if _, ok := m.Comments["T.z"]; ok {
+		t.Fatal("Unexpected doc for unexported field T.z.")
+	}
+}
+
+func TestGroupedDecls(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Numbers.
+const (
+	// A is one.
+	A = 1
+	B = 2 // B is two.
+	C = 3
+)
+
+// V is a var.
+var V = 1
+
+type (
+	// T is a type.
+	T int
+	// U is another type.
+	U struct {
+		// F is a field.
+		F int
+	}
+)
+`,
+	})
+	tests := map[string]string{
+		"A":   "A is one.\n",
+		"B":   "B is two.\n",
+		"C":   "Numbers.\n",
+		"V":   "V is a var.\n",
+		"T":   "T is a type.\n",
+		"U":   "U is another type.\n",
+		"U.F": "F is a field.\n",
+	}
+	for name, expected := range tests {
+		if found := m.Comments[name]; found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestMethodDocs(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type Tree[K comparable, V any] struct{}
+
+// Insert inserts.
+func (t *Tree[K, V]) Insert(k K, v V) {}
+
+type List[T any] []T
+
+// Len returns the length.
+func (l List[T]) Len() int { return len(l) }
+
+type Conn struct{}
+
+// Close closes.
+func (c *Conn) Close() {}
+
+// Name returns the name.
+func (Conn) Name() string { return "" }
+`,
+	})
+	for _, name := range []string{"Tree.Insert", "List.Len", "Conn.Close", "Conn.Name"} {
+		if _, ok := m.Comments[name]; !ok {
+			t.Fatalf("Expected doc for %s.", name)
+		}
+	}
+}
+
+func TestSkipUnparseable(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things.
+func Foo() {}
+`,
+		"bar.go": `package foo
+
+func Bar() {
+`,
+	})
+	if _, ok := m.Comments["Foo"]; !ok {
+		t.Fatal("Expected doc for Foo.")
+	}
+	if len(m.Errors) != 1 || !strings.Contains(m.Errors[0].Error(), "bar.go") {
+		t.Fatalf("Expected one error for bar.go. Found %v.", m.Errors)
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo.go":                "package foo\n\n// Connect is in the root.\nfunc Connect() {}\n",
+		"client/client.go":      "package client\n\n// Connect is in the client.\nfunc Connect() {}\n\ntype Conn struct{}\n\n// Close closes. It really does.\nfunc (c *Conn) Close() {}\n",
+		"client/client_test.go": "package client\n\nimport \"fmt\"\n\nfunc ExampleConnect() {\n\tfmt.Println(\"a\")\n\t// Output: a\n}\n",
+		"internal/db/db.go":     "package db\n\n// Open opens.\nfunc Open() {}\n",
+		"client/new.go":         "package client\n\n// New makes a client.\nfunc New() {}\n",
+		"server/server.go":      "package server\n\n// New makes a server.\nfunc New() {}\n",
+		"testdata/data.go":      "package data\n\n// Data is skipped.\nfunc Data() {}\n",
+		"_skip/skip.go":         "package skip\n\n// Skip is skipped.\nfunc Skip() {}\n",
+		"empty/README":          "no go files",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewRecursiveCodeMap("example.com/foo", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"Connect":              "Connect is in the root.",
+		"client.Connect":       "Connect is in the client.",
+		"client.Conn.Close":    "Close closes. It really does.",
+		"client.Conn.Close[1]": "It really does.",
+		"internal/db.Open":     "Open opens.",
+		"client.New":           "New makes a client.",
+		"server.New":           "New makes a server.",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if found, err := m.Output("client.ExampleConnect"); err != nil || found != "a" {
+		t.Fatalf("Expected output a. Found %s (%v).", strconv.Quote(found), err)
+	}
+	if len(m.Packages) != 3 {
+		t.Fatalf("Expected 3 subpackages. Found %d.", len(m.Packages))
+	}
+	expected := "New is ambiguous, use one of client.New, server.New"
+	if _, err := m.Doc("New"); err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %s. Found %v.", strconv.Quote(expected), err)
+	}
+	if _, err := m.Signature("New"); err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %s. Found %v.", strconv.Quote(expected), err)
+	}
+}
+
+func TestCodeMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pkg/foo/foo.go":      {Data: []byte("package foo\n\n// Foo does things.\nfunc Foo() {}\n")},
+		"pkg/foo/foo_test.go": {Data: []byte("package foo_test\n\nimport \"fmt\"\n\nfunc ExampleFoo() {\n\tfmt.Println(\"a\")\n\t// Output: a\n}\n")},
+		"pkg/foo/README.md":   {Data: []byte("not go")},
+		"pkg/bar/bar.go":      {Data: []byte("package bar\n\n// Bar does things.\nfunc Bar() {}\n")},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, "pkg/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "foo" {
+		t.Fatalf("Expected package name foo. Found %s.", m.Name)
+	}
+	if found := m.DocFunc("Foo"); found != "Foo does things." {
+		t.Fatalf("Expected doc for Foo. Found %s.", strconv.Quote(found))
+	}
+	if found := m.OutputFunc("ExampleFoo"); found != "a" {
+		t.Fatalf("Expected output a. Found %s.", strconv.Quote(found))
+	}
+	if _, ok := m.Comments["Bar"]; ok {
+		t.Fatal("Unexpected doc for Bar in another directory.")
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go":      {Data: []byte("package foo\n\n// Foo does things.\nfunc Foo() {}\n")},
+		"mock_gen.go": {Data: []byte("package foo\n\n// Mock is generated.\nfunc Mock() {}\n")},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".", WithFileFilter(func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_gen.go")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Comments["Foo"]; !ok {
+		t.Fatal("Expected doc for Foo.")
+	}
+	if _, ok := m.Comments["Mock"]; ok {
+		t.Fatal("Unexpected doc for Mock in filtered file.")
+	}
+}
+
+func TestPlaygroundNotPlayable(t *testing.T) {
+	// the example in the testing package is in the package under test, so
+	// doc.Examples doesn't make a playable program.
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Examples["ExampleFoo"].Play != nil {
+		t.Fatal("Expected nil Play.")
+	}
+	if _, err := m.Playground("ExampleFoo"); err == nil || !strings.Contains(err.Error(), "no playable form") {
+		t.Fatalf("Expected no playable form error. Found %v.", err)
+	}
+}
+
+func TestExampleClosingBrace(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo_test
+
+import "fmt"
+
+func ExampleFoo() {
+	// foo
+	fmt.Println("a")
+	// Output: a
+}
+
+func ExampleBar() {
+	if true {
+		fmt.Println("a")
+	}
+
+}
+`,
+	})
+	tests := []struct {
+		name, plain, play string
+	}{
+		{
+			name:  "ExampleFoo",
+			plain: "{\n\t// foo\n\tfmt.Println(\"a\")\n}",
+			play:  "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\t// foo\n\tfmt.Println(\"a\")\n}",
+		},
+		{
+			name:  "ExampleBar",
+			plain: "{\n\tif true {\n\t\tfmt.Println(\"a\")\n\t}\n}",
+			play:  "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\tif true {\n\t\tfmt.Println(\"a\")\n\t}\n}",
+		},
+	}
+	for _, test := range tests {
+		if found := m.ExampleFunc(true)(test.name); found != test.plain {
+			t.Fatalf("Example: %s. Expected %s. Found %s.", test.name, strconv.Quote(test.plain), strconv.Quote(found))
+		}
+		if found := m.PlaygroundFunc(test.name); found != test.play {
+			t.Fatalf("Example: %s. Expected %s. Found %s.", test.name, strconv.Quote(test.play), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExampleAlignment(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleSingle() { fmt.Println("a") }
+
+func ExampleBlock() {
+	fmt.Println("a")
+	if true {
+		fmt.Println("b")
+	}
+}
+`,
+	})
+	tests := map[string]string{
+		"ExampleSingle": "```go\nfmt.Println(\"a\")\n```",
+		"ExampleBlock":  "```go\nfmt.Println(\"a\")\nif true {\n\tfmt.Println(\"b\")\n}\n```",
+	}
+	for name, expected := range tests {
+		if found := m.ExampleFunc(false)(name); found != expected {
+			t.Fatalf("Example: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+
+	// code that isn't a block, e.g. a single statement, is printed the same
+	e := *m.Examples["ExampleBlock"]
+	e.Code = e.Code.(*ast.BlockStmt).List[1]
+	if found, expected := m.exampleCode(&e, nil), "if true {\n\tfmt.Println(\"b\")\n}"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestExamplePlainOutput(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo_test
+
+import "fmt"
+
+func ExampleA() {
+	fmt.Println("a")
+	// Output:
+	// a
+}
+
+func ExampleB() {
+	fmt.Println("b")
+	fmt.Println("c")
+	// Unordered output:
+	// c
+	// b
+}
+
+func ExampleC() {
+	fmt.Println("\n\t// Output: not a comment")
+}
+`,
+	})
+	tests := map[string]string{
+		"ExampleA": "{\n\tfmt.Println(\"a\")\n}",
+		"ExampleB": "{\n\tfmt.Println(\"b\")\n\tfmt.Println(\"c\")\n}",
+		"ExampleC": "{\n\tfmt.Println(\"\\n\\t// Output: not a comment\")\n}",
+	}
+	for name, expected := range tests {
+		if found := m.ExampleFunc(true)(name); found != expected {
+			t.Fatalf("Example: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestOutputUnordered(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo_test
+
+import "fmt"
+
+func ExampleA() {
+	fmt.Println("a")
+	// Output: a
+}
+
+func ExampleB() {
+	fmt.Println("b")
+	fmt.Println("c")
+	// Unordered output:
+	// c
+	// b
+}
+`,
+	})
+	if m.OutputUnorderedFunc("ExampleA") {
+		t.Fatal("Expected ExampleA to be ordered.")
+	}
+	if !m.OutputUnorderedFunc("ExampleB") {
+		t.Fatal("Expected ExampleB to be unordered.")
+	}
+	if found := m.OutputFunc("ExampleB"); found != "c\nb" {
+		t.Fatalf("Expected output. Found %s.", strconv.Quote(found))
+	}
+	if _, err := m.OutputUnordered("ExampleC"); err == nil {
+		t.Fatal("Expected error for unknown example.")
+	}
+}
+
+func TestSignature(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type Option func()
+
+type Conn struct{}
+
+// Connect connects.
+func Connect(addr string, opts ...Option) (*Conn, error) {
+	return nil, nil
+}
+
+func (c *Conn) Close() error { return nil }
+
+type Tree[K comparable, V any] struct{}
+
+func (t *Tree[K, V]) Insert(k K, v V) (old V, ok bool) { return }
+
+func Map[T, U any](in []T, f func(T) U) []U { return nil }
+`,
+	})
+	tests := map[string]string{
+		"Connect":     "```go\nfunc Connect(addr string, opts ...Option) (*Conn, error)\n```",
+		"Conn.Close":  "```go\nfunc (c *Conn) Close() error\n```",
+		"Tree.Insert": "```go\nfunc (t *Tree[K, V]) Insert(k K, v V) (old V, ok bool)\n```",
+		"Map":         "```go\nfunc Map[T, U any](in []T, f func(T) U) []U\n```",
+	}
+	for name, expected := range tests {
+		found, err := m.Signature(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	for _, name := range []string{"Conn", "Missing"} {
+		if _, err := m.Signature(name); err == nil {
+			t.Fatalf("Name: %s. Expected error.", name)
+		}
+	}
+}
+
+func TestDecl(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Config is the config.
+type Config struct {
+	// Name is the name.
+	Name string
+	Size int // in bytes
+}
+
+// Reader reads.
+type Reader interface {
+	// Read reads.
+	Read(p []byte) (n int, err error)
+}
+
+// Colors.
+const (
+	Red   = iota // red
+	Green        // green
+)
+
+type (
+	A int
+	// B is b.
+	B string
+)
+`,
+	})
+	tests := map[string]string{
+		"Config": "```go\ntype Config struct {\n\t// Name is the name.\n\tName string\n\tSize int // in bytes\n}\n```",
+		"Reader": "```go\ntype Reader interface {\n\t// Read reads.\n\tRead(p []byte) (n int, err error)\n}\n```",
+		"Green":  "```go\nconst (\n\tRed   = iota // red\n\tGreen        // green\n)\n```",
+		"B":      "```go\ntype B string\n```",
+	}
+	for name, expected := range tests {
+		found, err := m.Decl(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Decl("Missing"); err == nil {
+		t.Fatal("Expected error for missing declaration.")
+	}
+}
+
+func TestBody(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo is foo.
+func Foo() int {
+	// a is a
+	a := 1
+	return a // done
+}
+
+type T struct{}
+
+func (T) Bar() {
+	if true {
+		println("bar")
+	}
+	// trailing
+}
+`,
+	})
+	tests := map[string]string{
+		"Foo":   "```go\n// a is a\na := 1\nreturn a // done\n```",
+		"T.Bar": "```go\nif true {\n\tprintln(\"bar\")\n}\n// trailing\n```",
+	}
+	for name, expected := range tests {
+		found, err := m.Body(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Body("T"); err == nil {
+		t.Fatal("Expected error for non-function.")
+	}
+}
+
+func TestLink(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Conn is a connection.
+type Conn struct{}
+
+// Close closes.
+func (c *Conn) Close() {}
+
+func Connect() {}
+`,
+	})
+	tests := map[string]string{
+		"Conn.Close": "[Conn.Close](https://pkg.go.dev/example.com/foo#Conn.Close)",
+		"Connect":    "[Connect](https://pkg.go.dev/example.com/foo#Connect)",
+	}
+	for name, expected := range tests {
+		found, err := m.Link(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	m.GodocURL = "https://godoc.example.com"
+	expected := "[Conn](https://godoc.example.com/example.com/foo#Conn)"
+	if found := m.LinkFunc("Conn"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.Link("Missing"); err == nil {
+		t.Fatal("Expected error for missing declaration.")
+	}
+}
+
+func TestExampleList(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type T struct{}
+
+func (T) M() {}
+
+type TU struct{}
+`,
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleTU() {
+	fmt.Println("tu")
+	// Output: tu
+}
+
+func ExampleT_M() {
+	T{}.M()
+}
+
+func ExampleT() {
+	fmt.Println("t")
+	// Output: t
+}
+`,
+	})
+	names := strings.Join(m.ExampleNames(), " ")
+	if expected := "ExampleT ExampleT_M ExampleTU"; names != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(names))
+	}
+	expected := "### ExampleT\n\n```go\nfmt.Println(\"t\")\n// Output: t\n```\n\n" +
+		"### ExampleT_M\n\n```go\nT{}.M()\n```\n\n" +
+		"### ExampleTU\n\n```go\nfmt.Println(\"tu\")\n// Output: tu\n```"
+	if found := m.ExampleListFunc(); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestFence(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\n// Foo does things.\n//\n//\tFoo(1)\nfunc Foo(a int) {}\n",
+		"foo_test.go": `package foo
+
+func ExampleFoo() {
+	Foo(1)
+}
+`,
+	})
+	m.FenceChar = '~'
+	if found, expected := m.DocFunc("Foo"), "Foo does things.\n\n~~~\nFoo(1)\n~~~"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	m.FenceLang = "golang"
+	tests := map[string]func() (string, error){
+		"~~~golang\nFoo(1)\n~~~":                     func() (string, error) { return m.Example("ExampleFoo", false) },
+		"~~~golang\nfunc Foo(a int)\n~~~":            func() (string, error) { return m.Signature("Foo") },
+		"~~~golang\nfunc Foo(a int) {}\n~~~":         func() (string, error) { return m.Decl("Foo") },
+		"Foo does things.\n\n~~~golang\nFoo(1)\n~~~": func() (string, error) { return m.Doc("Foo") },
+	}
+	for expected, f := range tests {
+		found, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	expected := "{\n\tFoo(1)\n}"
+	if found := m.ExampleFunc(true)("ExampleFoo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		pkg, name string
+		alias     []string
+		expected  string
+	}{
+		{"github.com/dave/jennifer/jen", "jen", nil, "```go\nimport \"github.com/dave/jennifer/jen\"\n```"},
+		{"github.com/dave/jennifer/jen", "jen", []string{"j"}, "```go\nimport j \"github.com/dave/jennifer/jen\"\n```"},
+		{"github.com/foo/go-bar", "bar", nil, "```go\nimport bar \"github.com/foo/go-bar\"\n```"},
+		{"github.com/foo/bar/v2", "bar", nil, "```go\nimport \"github.com/foo/bar/v2\"\n```"},
+		{"gopkg.in/yaml.v3", "yaml", nil, "```go\nimport \"gopkg.in/yaml.v3\"\n```"},
+		{"./foo", "foo", nil, "```go\nimport \"foo\" // import path unknown, package foo\n```"},
+	}
+	for _, test := range tests {
+		m := &CodeMap{pkg: test.pkg, Name: test.name}
+		found, err := m.Import(test.alias...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Fatalf("Package: %s. Expected %s. Found %s.", test.pkg, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestExamplesFor(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type Conn struct{}
+
+func (Conn) Close() {}
+`,
+		"foo_test.go": `package foo
+
+func ExampleConn_Close_timeout() {
+	Conn{}.Close() // timeout
+}
+
+func ExampleConn_Close() {
+	Conn{}.Close()
+}
+
+func ExampleConn() {
+	_ = Conn{}
+}
+
+func Example_usage() {
+	_ = Conn{}
+}
+`,
+	})
+	var names []string
+	for _, e := range m.ExamplesFor("Conn.Close") {
+		names = append(names, e.Name)
+	}
+	if found, expected := strings.Join(names, " "), "Conn_Close Conn_Close_timeout"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if found := len(m.ExamplesFor("")); found != 1 {
+		t.Fatalf("Expected 1 package example. Found %d.", found)
+	}
+	if found := ExampleSuffix("ExampleConn_Close_timeout"); found != "timeout" {
+		t.Fatalf("Expected suffix timeout. Found %s.", strconv.Quote(found))
+	}
+	expected := "### Example\n\n```go\nConn{}.Close()\n```\n\n### Example (Timeout)\n\n```go\nConn{}.Close() // timeout\n```"
+	if found := m.ExamplesForFunc("Conn.Close"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	expected = "```go\n_ = Conn{}\n```"
+	if found := m.ExamplesForFunc("Conn"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.ExamplesForList("Missing"); err == nil {
+		t.Fatal("Expected error for missing examples.")
+	}
+}
+
+func TestReceiverCollision(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"conn.go": `package foo
+
+type Conn struct{}
+
+// Open opens.
+func (c *Conn) Open() {}
+`,
+		"conn_value.go": `package foo
+
+// Close closes the value.
+func (c Conn) Close() {}
+`,
+		"conn_pointer.go": `package foo
+
+// Close closes the pointer.
+func (c *Conn) Close() {}
+`,
+	})
+	tests := map[string]string{
+		"Conn.Open":     "Open opens.",
+		"Conn.Close":    "Close closes the value.",
+		"(*Conn).Close": "Close closes the pointer.",
+	}
+	for name, expected := range tests {
+		found, err := m.Doc(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if len(m.Errors) != 1 || !strings.Contains(m.Errors[0].Error(), "Conn.Close has both value and pointer receivers") {
+		t.Fatalf("Expected collision error. Found %v.", m.Errors)
+	}
+}
+
+func TestInterfaceMethods(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+import "io"
+
+// ReadCloser reads and closes.
+type ReadCloser interface {
+	// Reader is embedded.
+	io.Reader
+	// Close closes.
+	Close() error
+	Flush() // Flush flushes.
+	reset()
+}
+`,
+	})
+	tests := map[string]string{
+		"ReadCloser.Reader": "Reader is embedded.",
+		"ReadCloser.Close":  "Close closes.",
+		"ReadCloser.Flush":  "Flush flushes.",
+	}
+	for name, expected := range tests {
+		found, err := m.Doc(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	expected := "```go\nClose() error\n```"
+	if found := m.SignatureFunc("ReadCloser.Close"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.Signature("ReadCloser.Reader"); err == nil {
+		t.Fatal("Expected error for embedded interface.")
+	}
+	if _, ok := m.Comments["ReadCloser.reset"]; ok {
+		t.Fatal("Expected unexported method to be skipped.")
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things. It is fast and small. Use it often.
+func Foo() {}
+`,
+	})
+	if found := m.WordCountFunc("Foo"); found != 11 {
+		t.Fatalf("Expected 11 words. Found %d.", found)
+	}
+	if found := m.WordCountFunc("Foo[1:]"); found != 8 {
+		t.Fatalf("Expected 8 words. Found %d.", found)
+	}
+	tests := map[int]string{
+		0: "1 min read",
+		5: "3 min read",
+		4: "3 min read",
+		3: "4 min read",
+	}
+	for wpm, expected := range tests {
+		if found := m.ReadingTimeFunc("Foo", wpm); found != expected {
+			t.Fatalf("WPM: %d. Expected %s. Found %s.", wpm, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.ReadingTime("Bar", 0); err == nil {
+		t.Fatal("Expected error for missing doc.")
+	}
+}
+
+func TestStripIdentPrefix(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type Conn struct{}
+
+// Close closes the connection. It is safe.
+func (Conn) Close() {}
+
+// Resetting the connection is slow.
+func (Conn) Reset() {}
+
+// A Dialer dials.
+type Dialer struct{}
+`,
+	})
+	m.StripIdentPrefix = true
+	tests := map[string]string{
+		"Conn.Close":    "Closes the connection. It is safe.",
+		"Conn.Close[0]": "Closes the connection.",
+		"Conn.Close{0}": "Closes",
+		"Conn.Reset":    "Resetting the connection is slow.",
+		"Dialer":        "A Dialer dials.",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	fsys := fstest.MapFS{
+		"server.go": {Data: []byte("package foo\n")},
+		"server_linux.go": {Data: []byte(`package foo
+
+// Serve serves on linux.
+func Serve() {}
+`)},
+		"server_windows.go": {Data: []byte(`package foo
+
+// Serve serves on windows.
+func Serve() {}
+`)},
+		"tagged.go": {Data: []byte(`//go:build darwin && arm64
+
+package foo
+
+// Tagged is only on darwin/arm64.
+func Tagged() {}
+`)},
+	}
+	tests := []struct {
+		goos, goarch, serve string
+		tagged              bool
+	}{
+		{"linux", "amd64", "Serve serves on linux.", false},
+		{"windows", "amd64", "Serve serves on windows.", false},
+		{"darwin", "arm64", "", true},
+	}
+	for _, test := range tests {
+		m, err := NewCodeMapFS("example.com/foo", fsys, ".", WithPlatform(test.goos, test.goarch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := m.Comments["Serve"]; strings.TrimSpace(found) != test.serve {
+			t.Fatalf("Platform: %s/%s. Expected %s. Found %s.", test.goos, test.goarch, strconv.Quote(test.serve), strconv.Quote(found))
+		}
+		if _, found := m.Comments["Tagged"]; found != test.tagged {
+			t.Fatalf("Platform: %s/%s. Expected Tagged %v. Found %v.", test.goos, test.goarch, test.tagged, found)
+		}
+	}
+}
+
+func TestExampleDocs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go": {Data: []byte("package foo\n\ntype Conn struct{}\n\nfunc (Conn) Close() {}\n")},
+		"foo_test.go": {Data: []byte(`package foo
+
+// Close the connection when you're done.
+//
+// Output: is ignored.
+func ExampleConn_Close() {
+	// Output:
+}
+
+// Time out.
+func ExampleConn_Close_timeout() {}
+
+func ExampleConn() {}
+`)},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".", WithExampleDocs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"Example.Conn.Close":         "Close the connection when you're done.",
+		"Example.Conn.Close_timeout": "Time out.",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, ok := m.Comments["Example.Conn"]; ok {
+		t.Fatal("Expected no doc for ExampleConn.")
+	}
+	if len(m.Examples) != 3 {
+		t.Fatalf("Expected 3 examples. Found %d.", len(m.Examples))
+	}
+
+	m, err = NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Comments["Example.Conn.Close"]; ok {
+		t.Fatal("Expected no example docs without WithExampleDocs.")
+	}
+}
+
+func TestExampleWithOutput(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleA() {
+	fmt.Println("a")
+	// Output: a
+}
+
+func ExampleB() {
+	fmt.Println("b")
+	fmt.Println("c")
+	// Unordered output:
+	// c
+	// b
+}
+
+func ExampleC() {
+	fmt.Println("c")
+}
+`,
+	})
+	tests := map[string]string{
+		"ExampleA": "```go\nfmt.Println(\"a\")\n```\n\nOutput:\n\n```\na\n```",
+		"ExampleB": "```go\nfmt.Println(\"b\")\nfmt.Println(\"c\")\n```\n\nUnordered output:\n\n```\nc\nb\n```",
+		"ExampleC": "```go\nfmt.Println(\"c\")\n```",
+	}
+	for in, expected := range tests {
+		found, err := m.ExampleWithOutput(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+type Conn struct{}
+
+// Open opens the connection. It may block.
+func (c *Conn) Open() error { return nil }
+
+// Close closes.
+func (c Conn) Close() {}
+
+func (c Conn) Dial(addr string) {}
+
+func (c Conn) reset() {}
+
+type Closer interface {
+	// Close closes. Once.
+	Close() error
+	io.Reader
+}
+
+type Empty struct{}
+`,
+	})
+	tests := map[string]string{
+		"Conn": "```go\nfunc (c Conn) Close()\n```\n\nClose closes.\n\n" +
+			"```go\nfunc (c Conn) Dial(addr string)\n```\n\n" +
+			"```go\nfunc (c *Conn) Open() error\n```\n\nOpen opens the connection.",
+		"Closer": "```go\nClose() error\n```\n\nClose closes.",
+	}
+	for in, expected := range tests {
+		found, err := m.Methods(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Methods("Empty"); err == nil || err.Error() != "no methods of Empty found" {
+		t.Fatalf("Expected error. Found %v.", err)
+	}
+}
+
+func TestPackageDoc(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"a.go": "// Package foo does things.\npackage foo\n",
+				"b.go": "// More things.\npackage foo\n",
+			},
+			"Package foo does things.\n\nMore things.",
+		},
+		{
+			map[string]string{
+				"a.go":   "// Package foo does things.\npackage foo\n",
+				"doc.go": "// Package foo is documented here.\npackage foo\n",
+			},
+			"Package foo is documented here.",
+		},
+	}
+	for _, test := range tests {
+		m := newTestCodeMap(t, test.files)
+		found, err := m.PackageDoc()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(test.expected), strconv.Quote(found))
+		}
+		if m.Comments["a_go"] != "Package foo does things.\n" {
+			t.Fatalf("Expected the file doc. Found %s.", strconv.Quote(m.Comments["a_go"]))
+		}
+	}
+	m := newTestCodeMap(t, map[string]string{"a.go": "package foo\n"})
+	if _, err := m.PackageDoc(); err == nil || err.Error() != "package doc for example.com/foo not found" {
+		t.Fatalf("Expected error. Found %v.", err)
+	}
+}
+
+func TestDocOr(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go":      "package foo\n\n// Foo does things. Well.\nfunc Foo() {}\n\nfunc Bar() {}\n",
+		"foo_test.go": "package foo\n\nfunc ExampleFoo() {\n\tFoo()\n}\n",
+	})
+	tests := map[string]string{
+		"Foo":    "Foo does things. Well.",
+		"Foo[0]": "Foo does things.",
+		"Bar":    "fallback",
+		"Bar[0]": "fallback",
+		"Baz{0}": "fallback",
+	}
+	for in, expected := range tests {
+		if found := m.DocOrFunc(in, "fallback"); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.DocOr("Foo[5]", "fallback"); err == nil {
+		t.Fatal("Expected error for out of range sentance.")
+	}
+	if found := m.ExampleOrFunc("ExampleFoo", ""); found != "```go\nFoo()\n```" {
+		t.Fatalf("Expected example. Found %s.", strconv.Quote(found))
+	}
+	if found := m.ExampleOrFunc("ExampleBar", ""); found != "" {
+		t.Fatalf("Expected empty fallback. Found %s.", strconv.Quote(found))
+	}
+}
+
+func TestPackageExample(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go":      "package foo\n\nfunc Foo() {}\n",
+		"foo_test.go": "package foo\n\nfunc Example() {\n\tFoo()\n}\n\nfunc ExampleFoo() {\n\tFoo()\n\tFoo()\n}\n",
+	})
+	if found, expected := m.PackageExampleFunc(), "```go\nFoo()\n```"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if found, expected := m.PackageExampleFunc("lines=1"), "```go {1}\nFoo()\n```"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := m.PackageExample("lines=x"); err == nil {
+		t.Fatal("Expected error for invalid option.")
+	}
+	unused, err := m.Unreferenced(`{{ packageexample }}{{ "ExampleFoo" | example }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := strings.Join(unused, " "); found != "" {
+		t.Fatalf("Expected no unused examples. Found %s.", strconv.Quote(found))
+	}
+
+	m = newTestCodeMap(t, map[string]string{
+		"foo.go":      "package foo\n\nfunc Foo() {}\n",
+		"foo_test.go": "package foo\n\nfunc ExampleFoo() {\n\tFoo()\n}\n",
+	})
+	if found := m.PackageExampleFunc(); found != "" {
+		t.Fatalf("Expected no package example. Found %s.", strconv.Quote(found))
+	}
+	if errs := m.Validate(`{{ packageexample }}`); len(errs) != 0 {
+		t.Fatalf("Expected no errors. Found %v.", errs)
+	}
+}
+
+func TestFileDocHeaders(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"a.go": `// Copyright 2024 The Foo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+
+// Package foo does things.
+package foo
+`,
+		"b.go": `// Copyright 2024 The Foo Authors.
+//
+// +build linux
+//
+// More things.
+package foo
+`,
+		"c.go": `// SPDX-License-Identifier: MIT
+package foo
+`,
+	})
+	tests := map[string]string{
+		"a_go": "Package foo does things.\n",
+		"b_go": "More things.\n",
+	}
+	for name, expected := range tests {
+		if found := m.Comments[name]; found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, ok := m.Comments["c_go"]; ok {
+		t.Fatal("Expected no doc for c.go.")
+	}
+	expected := "Package foo does things.\n\nMore things."
+	if found := m.PackageDocFunc(); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestExportedOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go": {Data: []byte(`package foo
+
+// Public is public.
+func Public() {}
+
+// privateHelper is private.
+func privateHelper() {}
+
+// conn is private.
+type conn struct{}
+
+// Close closes.
+func (c *conn) Close() {}
+
+// Conn is public.
+type Conn struct{}
+
+// reset is private.
+func (c *Conn) reset() {}
+
+// max is private.
+const max = 1
+
+// Max is public.
+var Max = 1
+`)},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".", WithExportedOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Public", "Conn", "Max"} {
+		if _, ok := m.Comments[name]; !ok {
+			t.Fatalf("Expected %s.", name)
+		}
+	}
+	for _, name := range []string{"privateHelper", "conn", "conn.Close", "Conn.reset", "max"} {
+		if _, ok := m.Comments[name]; ok {
+			t.Fatalf("Expected no doc for %s.", name)
+		}
+		if _, ok := m.Decls[name]; ok {
+			t.Fatalf("Expected no decl for %s.", name)
+		}
+	}
+	m, err = NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Comments["privateHelper"]; !ok {
+		t.Fatal("Expected privateHelper by default.")
+	}
+}
+
+func TestExampleImports(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\nfunc Foo() string { return \"\" }\n",
+		"foo_test.go": `package foo_test
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/foo"
+)
+
+func ExampleFoo() {
+	fmt.Println(strings.ToUpper(foo.Foo()))
+}
+
+func ExampleNone() {
+	_ = 1
+}
+`,
+		"internal_test.go": `package foo
+
+import "fmt"
+
+func ExampleInternal() {
+	fmt.Println(Foo())
+}
+`,
+	})
+	tests := []struct {
+		name     string
+		options  []string
+		expected string
+	}{
+		{"ExampleFoo", []string{"imports"}, "```go\nimport (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"example.com/foo\"\n)\n\nfmt.Println(strings.ToUpper(foo.Foo()))\n```"},
+		{"ExampleFoo", []string{"imports", "lines=1"}, "```go {8}\nimport (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"example.com/foo\"\n)\n\nfmt.Println(strings.ToUpper(foo.Foo()))\n```"},
+		{"ExampleFoo", nil, "```go\nfmt.Println(strings.ToUpper(foo.Foo()))\n```"},
+		{"ExampleNone", []string{"imports"}, "```go\n_ = 1\n```"},
+		{"ExampleInternal", []string{"imports"}, "```go\nfmt.Println(Foo())\n```"},
+	}
+	for _, test := range tests {
+		found, err := m.Example(test.name, false, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Fatalf("Input: %s %v. Expected %s. Found %s.", test.name, test.options, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+}
+
+func TestNoteMarkers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo.go": {Data: []byte(`package foo
+
+// SECURITY(team): Foo trusts
+// its input.
+
+// Foo does things.
+//
+// PERF: Foo is slow
+// on large inputs.
+// BUG(dave): Foo is broken.
+func Foo() {}
+
+// PERF: Bar allocates.
+//
+// Bar does things.
+func Bar() {}
+`)},
+	}
+	m, err := NewCodeMapFS("example.com/foo", fsys, ".", WithNoteMarkers("PERF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"SECURITY": "- team: Foo trusts its input.",
+		"PERF":     "- Foo is slow on large inputs.\n- Bar allocates.",
+		"BUG":      "- dave: Foo is broken.",
+	}
+	for marker, expected := range tests {
+		if found := m.NotesFunc(marker); found != expected {
+			t.Fatalf("Marker: %s. Expected %s. Found %s.", marker, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	m, err = NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := m.NotesFunc("PERF"); found != "" {
+		t.Fatalf("Expected no PERF notes by default. Found %s.", strconv.Quote(found))
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo does things.
+//
+// Deprecated: use Bar, which
+// is faster.
+//
+// It was slow.
+func Foo() {}
+
+// Bar does things.
+func Bar() {}
+`,
+	})
+	tests := map[string]string{
+		"Foo": "Deprecated: use Bar, which\nis faster.",
+		"Bar": "",
+	}
+	for in, expected := range tests {
+		if found := m.DeprecatedFunc(in); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	m.StripDeprecated = true
+	docs := map[string]string{
+		"Foo":    "Foo does things.\n\nIt was slow.",
+		"Foo[1]": "It was slow.",
+		"Bar":    "Bar does things.",
+	}
+	for in, expected := range docs {
+		if found := m.DocFunc(in); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Deprecated("Missing"); err == nil {
+		t.Fatal("Expected error for missing doc.")
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+//go:generate mockgen -source foo.go
+func Generated() {}
+
+//nolint:errcheck
+func Unchecked() {}
+
+//nolint
+type Linted struct{}
+
+// Foo does things.
+//
+//go:noinline
+//nolint:gocyclo
+func Foo() {}
+`,
+	})
+	for _, name := range []string{"Generated", "Unchecked", "Linted"} {
+		if c, ok := m.Comments[name]; ok {
+			t.Fatalf("Expected %s to be undocumented. Found %s.", name, strconv.Quote(c))
+		}
+		if _, err := m.Doc(name); err == nil {
+			t.Fatalf("Expected error for %s.", name)
+		}
+	}
+	expected := "Foo does things."
+	if found := m.DocFunc("Foo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestTruncatedOutput(t *testing.T) {
+	var numbers, lines []string
+	for i := 1; i <= 50; i++ {
+		numbers = append(numbers, strconv.Itoa(i))
+		lines = append(lines, "\t// "+strconv.Itoa(i))
+	}
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": "package foo\n\nfunc ExampleA() {\n\t// Output:\n" + strings.Join(lines, "\n") + "\n}\n\n" +
+			"func ExampleB() {\n\t// Output:\n\t// abcdefgh\n\t// ab\n}\n",
+	})
+	tests := []struct {
+		in       string
+		maxLines int
+		width    []int
+		expected string
+	}{
+		{"ExampleA", 10, nil, "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n... (40 more lines)"},
+		{"ExampleA", 49, nil, strings.Join(numbers[:49], "\n") + "\n... (1 more line)"},
+		{"ExampleB", 2, nil, "abcdefgh\nab"},
+		{"ExampleB", 0, []int{3}, "abc\ndef\ngh\nab"},
+		{"ExampleB", 2, []int{3}, "abc\ndef\n... (2 more lines)"},
+	}
+	for _, test := range tests {
+		found := m.TruncatedOutputFunc(test.in, test.maxLines, test.width...)
+		if found != test.expected {
+			t.Fatalf("Input: %s %d %v. Expected %s. Found %s.", test.in, test.maxLines, test.width, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.TruncatedOutput("ExampleA", -1); err == nil {
+		t.Fatal("Expected an error for a negative line count.")
+	}
+}
+
+func TestFields(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+import "io"
+
+// Config configures things.
+type Config struct {
+	// Addr is the address. It has a port.
+	Addr string
+	X, Y int // X and Y are coordinates.
+	// Hook is called with a
+	// value.
+	Hook func(a int,
+		b string) error
+	hidden bool
+	*io.Reader
+	Table map[string]int ` + "`json:\"t|u\"`" + `
+}
+
+type Num int
+`,
+	})
+	expected := "| Field | Type | Description |\n| --- | --- | --- |\n" +
+		"| Addr | string | Addr is the address. |\n" +
+		"| X | int | X and Y are coordinates. |\n" +
+		"| Y | int | X and Y are coordinates. |\n" +
+		"| Hook | func(a int, b string) error | Hook is called with a value. |\n" +
+		"| Reader | *io.Reader |  |\n" +
+		"| Table | map[string]int |  |"
+	if found := m.FieldsFunc("Config"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	errors := map[string]string{
+		"Num":     "Num is not a struct",
+		"Missing": "type Missing not found",
+	}
+	for in, expected := range errors {
+		if _, err := m.Fields(in); err == nil || err.Error() != expected {
+			t.Fatalf("Input: %s. Expected error %s. Found %v.", in, strconv.Quote(expected), err)
+		}
+	}
+}
+
+func TestValueSpecNames(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+var a, b int // a and b are counters.
+
+// DefaultClient is the default.
+var DefaultClient = &struct{}{}
+
+// Hook is called on close.
+var Hook func() error
+
+var (
+	// X and Y are coordinates.
+	X, Y = 1, 2
+
+	_, Z = 3, 4 // Z is last.
+)
+
+const usage, short = "Usage: foo", "foo"
+`,
+	})
+	tests := map[string]string{
+		"a":             "a and b are counters.",
+		"b":             "a and b are counters.",
+		"DefaultClient": "DefaultClient is the default.",
+		"Hook":          "Hook is called on close.",
+		"X":             "X and Y are coordinates.",
+		"Y":             "X and Y are coordinates.",
+		"Z":             "Z is last.",
+	}
+	for in, expected := range tests {
+		found, err := m.Doc(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, ok := m.Decls["_"]; ok {
+		t.Fatal("Expected blank names to be skipped.")
+	}
+	if found, expected := m.UsageFunc("short"), "```\nfoo\n```"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestExampleFull(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\nfunc Foo() string { return \"\" }\n",
+		"foo_test.go": `package foo_test
+
+import (
+	"fmt"
+
+	"example.com/foo"
+)
+
+func ExampleFoo() {
+	fmt.Println(foo.Foo())
+	// Output:
+}
+`,
+		"internal_test.go": "package foo\n\nfunc ExampleInternal() {\n\tFoo()\n}\n",
+	})
+	program := "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/foo\"\n)\n\nfunc main() {\n\tfmt.Println(foo.Foo())\n}"
+	tests := []struct {
+		options  []string
+		expected string
+	}{
+		{[]string{"full"}, "```go\n" + program + "\n```"},
+		{[]string{"full", "imports"}, "```go\n" + program + "\n```"},
+		{[]string{"full", "lines=10"}, "```go {10}\n" + program + "\n```"},
+	}
+	for _, test := range tests {
+		found, err := m.Example("ExampleFoo", false, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.expected {
+			t.Fatalf("Input: %v. Expected %s. Found %s.", test.options, strconv.Quote(test.expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.Example("ExampleInternal", false, "full"); err == nil {
+		t.Fatal("Expected an error for an example with no program.")
+	}
+}
+
+func TestNoPackages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not go"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := "no Go packages found in " + dir
+	if _, err := NewCodeMap("example.com/foo", dir); err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %s. Found %v.", strconv.Quote(expected), err)
+	}
+	if _, err := NewRecursiveCodeMap("example.com/foo", dir); err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %s. Found %v.", strconv.Quote(expected), err)
+	}
+	fsys := fstest.MapFS{"empty/README.md": {Data: []byte("not go")}}
+	if _, err := NewCodeMapFS("example.com/foo", fsys, "empty"); err == nil || err.Error() != "no Go packages found in empty" {
+		t.Fatalf("Expected error for an empty FS directory. Found %v.", err)
+	}
+
+	// the root of a recursive scan needn't be a package
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "sub.go"), []byte("package sub\n\n// Sub is a sub.\nfunc Sub() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewRecursiveCodeMap("example.com/foo", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := m.DocFunc("sub.Sub"); found != "Sub is a sub." {
+		t.Fatalf("Expected doc for sub.Sub. Found %s.", strconv.Quote(found))
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	files := map[string]string{
+		"foo.go": "package foo\n\n// Foo does things.\n//\n//\tFoo()\n//\n// It is great.\nfunc Foo() string { return `a\nb` }\n\n/*\nBar is in a block.\n\nIt has two paragraphs.\n*/\nfunc Bar() {}\n",
+		"foo_test.go": `package foo_test
+
+import (
+	"fmt"
+
+	"example.com/foo"
+)
+
+// ExampleFoo shows Foo.
+func ExampleFoo() {
+	fmt.Println(foo.Foo())
+	// Output:
+	// a
+	// b
+}
+`,
+	}
+	crlf := map[string]string{}
+	for name, src := range files {
+		crlf[name] = strings.ReplaceAll(src, "\n", "\r\n")
+	}
+	lf, windows := newTestCodeMap(t, files), newTestCodeMap(t, crlf)
+	for _, in := range []string{"Foo", "Foo[1]", "Foo[2]", "Bar", "Bar¶[1]"} {
+		if expected, found := lf.DocFunc(in), windows.DocFunc(in); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	outputs := map[string]func(m *CodeMap) string{
+		"example":    func(m *CodeMap) string { return m.ExampleFunc(false)("ExampleFoo") },
+		"code":       func(m *CodeMap) string { return m.ExampleFunc(true)("ExampleFoo") },
+		"output":     func(m *CodeMap) string { return m.OutputFunc("ExampleFoo") },
+		"playground": func(m *CodeMap) string { return m.PlaygroundFunc("ExampleFoo") },
+		"decl":       func(m *CodeMap) string { return m.DeclFunc("Foo") },
+	}
+	for name, fn := range outputs {
+		if expected, found := fn(lf), fn(windows); found != expected {
+			t.Fatalf("Function: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if errs := windows.VerifyExamplesFormatted(); len(errs) != 0 {
+		t.Fatalf("Expected gofmt-clean examples. Found %v.", errs)
+	}
+}
+
+func TestTypeAliases(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+import "io"
+
+// Reader is an alias.
+type Reader = io.Reader
+
+// MyReader is a defined type.
+type MyReader io.Reader
+
+type List[T any] []T
+
+type Conn struct{}
+`,
+	})
+	signatures := map[string]string{
+		"Reader":   "```go\ntype Reader = io.Reader\n```",
+		"MyReader": "```go\ntype MyReader io.Reader\n```",
+		"List":     "```go\ntype List[T any] []T\n```",
+	}
+	for in, expected := range signatures {
+		if found := m.SignatureFunc(in); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if found, expected := m.DeclFunc("Reader"), "```go\ntype Reader = io.Reader\n```"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if found := m.AliasTargetFunc("Reader"); found != "io.Reader" {
+		t.Fatalf("Expected io.Reader. Found %s.", strconv.Quote(found))
+	}
+	errors := map[string]string{
+		"MyReader": "MyReader is not a type alias",
+		"Missing":  "type Missing not found",
+	}
+	for in, expected := range errors {
+		if _, err := m.AliasTarget(in); err == nil || err.Error() != expected {
+			t.Fatalf("Input: %s. Expected error %s. Found %v.", in, strconv.Quote(expected), err)
+		}
+	}
+	if _, err := m.Signature("Conn"); err == nil || err.Error() != "Conn is a struct or interface, see DeclFunc" {
+		t.Fatalf("Expected error for a struct. Found %v.", err)
+	}
+}
+
+func TestExampleFilter(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo.go":      "package foo\n",
+		"foo_test.go": "package foo\n\nfunc ExampleConn() {}\n\nfunc ExampleConn_Close() {}\n\nfunc Example_internalBench() {}\n\nfunc ExampleFoo() {}\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		options  []Option
+		expected []string
+	}{
+		{nil, []string{"Example_internalBench", "ExampleConn", "ExampleConn_Close", "ExampleFoo"}},
+		{[]Option{WithExampleExclude("Example_internal*")}, []string{"ExampleConn", "ExampleConn_Close", "ExampleFoo"}},
+		{[]Option{WithExampleInclude("ExampleConn*")}, []string{"ExampleConn", "ExampleConn_Close"}},
+		{[]Option{WithExampleInclude("ExampleConn*", "ExampleFoo"), WithExampleExclude("*_Close")}, []string{"ExampleConn", "ExampleFoo"}},
+	}
+	for _, test := range tests {
+		m, err := NewCodeMap("example.com/foo", dir, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := m.ExampleNames()
+		if strings.Join(found, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("Expected %v. Found %v.", test.expected, found)
+		}
+	}
+	if _, err := NewCodeMap("example.com/foo", dir, WithExampleExclude("[")); err == nil {
+		t.Fatal("Expected an error for an invalid pattern.")
+	}
+}
+
+func TestCollapsibleExample(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go":      "package foo\n",
+		"foo_test.go": "package foo\n\nfunc ExampleFoo() {\n\ta()\n}\n",
+	})
+	expected := "<details>\n<summary>Show &lt;code&gt;</summary>\n\n```go\na()\n```\n\n</details>"
+	if found := m.CollapsibleExampleFunc("Show <code>", "ExampleFoo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	m.Format = AsciiDoc
+	expected = "[%collapsible]\n.Show\n====\n[source,go]\n----\na()\n----\n===="
+	if found := m.CollapsibleExampleFunc("Show", "ExampleFoo"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	m.Format = RST
+	if _, err := m.CollapsibleExample("Show", "ExampleFoo"); err == nil {
+		t.Fatal("Expected an error for RST.")
+	}
+
+	m.Format = Markdown
+	errs := m.Validate(`{{ collapsible "Show" "ExampleFoo" }} {{ "ExampleBar" | collapsible "Show" }}`)
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), "example ExampleBar not found") {
+		t.Fatalf("Expected one error for ExampleBar. Found %v.", errs)
+	}
+}
@@ -0,0 +1,54 @@
+package rebecca
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regionRegex matches the markers delimiting a region updated by
+// UpdateRegions.
+var regionRegex = regexp.MustCompile(`<!--\s*rebecca:(start|end)\b(.*?)-->`)
+
+// UpdateRegions refreshes the generated regions of an existing document,
+// leaving the rest untouched. A region starts with a marker holding a
+// template, and ends with an end marker:
+//
+//	<!-- rebecca:start {{ "ExampleFoo" | example }} -->
+//	...
+//	<!-- rebecca:end -->
+//
+// The text between the markers is replaced with the rendered template. The
+// markers are kept, so the document can be updated again. Regions can't be
+// nested.
+func UpdateRegions(existing string, m *CodeMap) (string, error) {
+	var out string
+	var last int
+	var start []int // the open start marker
+	for _, match := range regionRegex.FindAllStringSubmatchIndex(existing, -1) {
+		kind := existing[match[2]:match[3]]
+		line := strings.Count(existing[:match[0]], "\n") + 1
+		switch {
+		case kind == "start" && start != nil:
+			return "", fmt.Errorf("line %d: nested rebecca:start marker, the region starting on line %d isn't closed", line, strings.Count(existing[:start[0]], "\n")+1)
+		case kind == "start":
+			start = match
+		case start == nil:
+			return "", fmt.Errorf("line %d: rebecca:end marker without rebecca:start", line)
+		default:
+			tpl := strings.TrimSpace(existing[start[4]:start[5]])
+			startLine := strings.Count(existing[:start[0]], "\n") + 1
+			rendered, err := m.execute(fmt.Sprintf("region on line %d", startLine), tpl)
+			if err != nil {
+				return "", fmt.Errorf("line %d: %v", startLine, err)
+			}
+			out += existing[last:start[1]] + "\n" + strings.Trim(rendered, "\n") + "\n"
+			last = match[0]
+			start = nil
+		}
+	}
+	if start != nil {
+		return "", fmt.Errorf("line %d: rebecca:start marker without rebecca:end", strings.Count(existing[:start[0]], "\n")+1)
+	}
+	return out + existing[last:], nil
+}
@@ -0,0 +1,45 @@
+package rebecca
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUpdateRegions(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := "# Hand written\n\n" +
+		"<!-- rebecca:start {{ \"Foo\" | doc }} -->\nstale\n<!-- rebecca:end -->\n\n" +
+		"More {{ hand }} written text.\n\n" +
+		"<!-- rebecca:start {{ \"ExampleFoo\" | output }} --><!-- rebecca:end -->\n"
+	expected := "# Hand written\n\n" +
+		"<!-- rebecca:start {{ \"Foo\" | doc }} -->\nFoo bar\n<!-- rebecca:end -->\n\n" +
+		"More {{ hand }} written text.\n\n" +
+		"<!-- rebecca:start {{ \"ExampleFoo\" | output }} -->\na\n<!-- rebecca:end -->\n"
+	found, err := UpdateRegions(existing, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	// updating again is a no-op
+	if again, err := UpdateRegions(found, m); err != nil || again != found {
+		t.Fatalf("Expected %s. Found %s (%v).", strconv.Quote(found), strconv.Quote(again), err)
+	}
+
+	failures := map[string]string{
+		"a\n<!-- rebecca:start {{ \"Foo\" | doc }} -->\n<!-- rebecca:start {{ \"Foo\" | doc }} -->\n<!-- rebecca:end -->": "line 3: nested",
+		"<!-- rebecca:end -->":                                           "line 1: rebecca:end marker without",
+		"\n<!-- rebecca:start {{ \"Foo\" | doc }} -->":                   "line 2: rebecca:start marker without",
+		"<!-- rebecca:start {{ \"Bar\" | doc }} --><!-- rebecca:end -->": "doc for Bar not found",
+	}
+	for in, expected := range failures {
+		if _, err := UpdateRegions(in, m); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Input: %s. Expected error containing %s. Found %v.", strconv.Quote(in), strconv.Quote(expected), err)
+		}
+	}
+}
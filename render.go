@@ -0,0 +1,265 @@
+package rebecca
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"text/template"
+)
+
+// FuncMap returns the template functions used by Render:
+//
+//	example, exampleor, packageexample, collapsible, code, output,
+//	truncatedoutput, outputtable, outputdiff, examplewithoutput,
+//	unordered, doc, docor, packagedoc, synopsis, plaintext, deprecated,
+//	doclinks, words, readingtime, notes, signature, aliastarget, methods,
+//	fields, decl, body, link, source, import, modulepath, goversion,
+//	usage, help, snippet, namedsnippet, consts, examples, examplesfor,
+//	entry, playground, playlink, badge, toc, slug, indent
+//
+// Functions return an error rather than panicking when a name is not found.
+// The functions in m.Funcs are added, replacing any built-in function with the
+// same name.
+func (m *CodeMap) FuncMap() template.FuncMap {
+	funcs := template.FuncMap{
+		"example":           func(in string, options ...string) (string, error) { return m.Example(in, false, options...) },
+		"exampleor":         m.ExampleOr,
+		"packageexample":    m.PackageExample,
+		"collapsible":       m.CollapsibleExample,
+		"code":              func(in string) (string, error) { return m.Example(in, true) },
+		"output":            m.Output,
+		"truncatedoutput":   m.TruncatedOutput,
+		"outputtable":       m.OutputTable,
+		"outputdiff":        m.OutputDiff,
+		"examplewithoutput": m.ExampleWithOutput,
+		"unordered":         m.OutputUnordered,
+		"doc":               m.Doc,
+		"docor":             m.DocOr,
+		"packagedoc":        m.PackageDoc,
+		"synopsis":          m.Synopsis,
+		"plaintext":         m.Plaintext,
+		"deprecated":        m.Deprecated,
+		"doclinks":          m.DocLinks,
+		"words":             m.WordCount,
+		"readingtime":       m.ReadingTime,
+		"notes":             m.NotesFunc,
+		"signature":         m.Signature,
+		"aliastarget":       m.AliasTarget,
+		"methods":           m.Methods,
+		"fields":            m.Fields,
+		"decl":              m.Decl,
+		"body":              m.Body,
+		"link":              m.Link,
+		"source":            m.SourceLink,
+		"import":            m.Import,
+		"modulepath":        m.ModulePathFunc,
+		"goversion":         m.GoVersionFunc,
+		"usage":             m.Usage,
+		"help":              m.Help,
+		"snippet":           m.Snippet,
+		"namedsnippet":      m.NamedSnippet,
+		"consts":            m.ConstValues,
+		"examples":          m.ExampleList,
+		"examplesfor":       m.ExamplesForList,
+		"entry":             m.Entry,
+		"playground":        m.Playground,
+		"playlink":          m.PlaygroundLink,
+		"badge":             m.Badge,
+		"toc":               func() string { return TOCPlaceholder },
+		"slug":              m.SlugFunc,
+		"indent":            m.IndentFunc,
+	}
+	for name, fn := range m.Funcs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Render executes the template file at templatePath with the functions from
+// m.FuncMap and returns the result. The delimiters are set by m.LeftDelim and
+// m.RightDelim.
+func Render(templatePath string, m *CodeMap) (string, error) {
+	b, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("can't read template, %v", err)
+	}
+	return m.render(filepath.Base(templatePath), string(b))
+}
+
+// RenderString executes the template text like Render, e.g. for a template
+// defined in Go code or a test. Errors refer to the template as "template".
+func RenderString(text string, m *CodeMap) (string, error) {
+	return m.render("template", text)
+}
+
+// render executes the template text and inserts the table of contents.
+func (m *CodeMap) render(name, text string) (string, error) {
+	out, err := m.execute(name, text)
+	if err != nil {
+		return "", err
+	}
+	return InsertTOC(out), nil
+}
+
+// RenderAll renders several template files with the same CodeMap, so the
+// package is only scanned once, e.g. for a README.md and a docs/API.md.
+// templates maps each output path to its template path, and the result maps
+// each output path to the rendered template. See Render.
+func RenderAll(templates map[string]string, m *CodeMap) (map[string]string, error) {
+	var outputs []string
+	for output := range templates {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+	out := map[string]string{}
+	for _, output := range outputs {
+		rendered, err := Render(templates[output], m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", templates[output], err)
+		}
+		out[output] = rendered
+	}
+	return out, nil
+}
+
+// htmlFuncs are the template functions that print HTML, with any text escaped,
+// when the format is HTML.
+var htmlFuncs = []string{
+	"example", "exampleor", "packageexample", "collapsible",
+	"examplewithoutput", "outputtable", "outputdiff", "doc", "docor",
+	"packagedoc", "deprecated", "doclinks", "signature", "methods",
+	"fields", "decl", "body", "import", "usage", "help", "snippet",
+	"namedsnippet", "consts", "examples", "examplesfor", "entry",
+	"playground",
+}
+
+// htmlFuncMap returns the functions from m.FuncMap for html/template. The
+// functions in htmlFuncs return template.HTML, so their output isn't escaped
+// again. indent takes the output of those functions as it is, and escapes any
+// other text.
+func (m *CodeMap) htmlFuncMap() htmltemplate.FuncMap {
+	funcs := htmltemplate.FuncMap(m.FuncMap())
+	if _, ok := m.Funcs["indent"]; !ok {
+		funcs["indent"] = func(prefix string, text any) htmltemplate.HTML {
+			s, ok := text.(htmltemplate.HTML)
+			if !ok {
+				s = htmltemplate.HTML(htmltemplate.HTMLEscapeString(fmt.Sprint(text)))
+			}
+			return htmltemplate.HTML(m.IndentFunc(htmltemplate.HTMLEscapeString(prefix), string(s)))
+		}
+	}
+	htmlType := reflect.TypeOf(htmltemplate.HTML(""))
+	for _, name := range htmlFuncs {
+		if _, ok := m.Funcs[name]; ok {
+			continue
+		}
+		fn := reflect.ValueOf(funcs[name])
+		t := fn.Type()
+		in := make([]reflect.Type, t.NumIn())
+		for i := range in {
+			in[i] = t.In(i)
+		}
+		out := make([]reflect.Type, t.NumOut())
+		for i := range out {
+			out[i] = t.Out(i)
+		}
+		out[0] = htmlType
+		funcs[name] = reflect.MakeFunc(reflect.FuncOf(in, out, t.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+			var results []reflect.Value
+			if t.IsVariadic() {
+				results = fn.CallSlice(args)
+			} else {
+				results = fn.Call(args)
+			}
+			results[0] = results[0].Convert(htmlType)
+			return results
+		}).Interface()
+	}
+	return funcs
+}
+
+// executor is implemented by text/template and html/template templates.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// execute parses and executes the template text with the functions from
+// m.FuncMap. If m.HTMLTemplate is set html/template is used.
+func (m *CodeMap) execute(name, text string) (string, error) {
+	var tpl executor
+	var err error
+	if m.HTMLTemplate {
+		if m.Format != HTML {
+			return "", errors.New("html/template requires the HTML format")
+		}
+		tpl, err = htmltemplate.New(name).
+			Delims(m.LeftDelim, m.RightDelim).
+			Funcs(m.htmlFuncMap()).
+			Parse(text)
+	} else {
+		tpl, err = template.New(name).
+			Delims(m.LeftDelim, m.RightDelim).
+			Funcs(m.FuncMap()).
+			Parse(text)
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't parse template, %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, nil); err != nil {
+		return "", fmt.Errorf("can't process template, %v", err)
+	}
+	return buf.String(), nil
+}
+
+// Process scans the package pkg in dir, renders the template file at
+// templatePath and writes the result to outputPath.
+func Process(templatePath, outputPath, pkg, dir string, options ...Option) error {
+	m, err := NewCodeMap(pkg, dir, options...)
+	if err != nil {
+		return err
+	}
+	out, err := Render(templatePath, m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(out), 0644); err != nil {
+		return fmt.Errorf("can't write output, %v", err)
+	}
+	return nil
+}
+
+// Check scans the package pkg in dir and renders the template file at
+// templatePath, like Process, but compares the result with the existing file
+// at outputPath instead of writing it. It reports whether the file is up to
+// date, and if not returns a unified diff from the file to the rendered
+// output. A missing output file is reported as out of date.
+func Check(templatePath, outputPath, pkg, dir string, options ...Option) (bool, string, error) {
+	m, err := NewCodeMap(pkg, dir, options...)
+	if err != nil {
+		return false, "", err
+	}
+	out, err := Render(templatePath, m)
+	if err != nil {
+		return false, "", err
+	}
+	return Compare(outputPath, out)
+}
+
+// Compare reports whether the file at outputPath matches rendered, and if not
+// returns a unified diff from the file to rendered. See Check.
+func Compare(outputPath, rendered string) (bool, string, error) {
+	existing, err := os.ReadFile(outputPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, "", fmt.Errorf("can't read output, %v", err)
+	}
+	diff := lineDiff(outputPath, outputPath+" (rendered)", string(existing), rendered)
+	return diff == "", diff, nil
+}
@@ -0,0 +1,274 @@
+package rebecca
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// processTemplate is rendered against the testing package by TestProcess and
+// TestCheck, to processOutput.
+const processTemplate = `# Test
+
+Doc:
+{{ "Foo" | doc }}
+
+Full:
+{{ "ExampleFoo" | example }}
+`
+
+const processOutput = "# Test\n\nDoc:\nFoo bar\n\nFull:\n```go\n// foo\nfmt.Println(\"a\")\n// Output:\n// a\n```\n"
+
+// writeProcessFixture writes processTemplate and processOutput to a temporary
+// directory and returns their paths.
+func writeProcessFixture(t *testing.T) (tpl, output string) {
+	dir := t.TempDir()
+	tpl, output = filepath.Join(dir, "README.md.tpl"), filepath.Join(dir, "README.md")
+	if err := os.WriteFile(tpl, []byte(processTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte(processOutput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tpl, output
+}
+
+func TestProcess(t *testing.T) {
+	tpl, _ := writeProcessFixture(t)
+	output := filepath.Join(t.TempDir(), "README.md")
+	if err := Process(tpl, output, "github.com/dave/rebecca/testing", "testing"); err != nil {
+		t.Fatal(err)
+	}
+	found, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(found) != processOutput {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(processOutput), strconv.Quote(string(found)))
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "README.md.tpl")
+	if err := os.WriteFile(path, []byte(`{{ "Bar" | doc }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Render(path, m); err == nil {
+		t.Fatal("Expected error for missing doc.")
+	}
+
+	// errors point at the action in the template, and suggest a similar name
+	if err := os.WriteFile(path, []byte("# Test\n\n{{ \"Fooo\" | doc }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Render(path, m)
+	if err == nil || !strings.Contains(err.Error(), "README.md.tpl:3:12:") || !strings.HasSuffix(err.Error(), "doc for Fooo not found, did you mean Foo?") {
+		t.Fatalf("Expected error with the position and a suggestion. Found %v.", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tpl, output := writeProcessFixture(t)
+	ok, diff, err := Check(tpl, output, "github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || diff != "" {
+		t.Fatalf("Expected up to date. Found %s.", strconv.Quote(diff))
+	}
+
+	if err := os.WriteFile(tpl, []byte("# Test\n\n{{ \"Foo\" | doc }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte("# Test\n\nFoo baz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ok, diff, err = Check(tpl, output, "github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--- " + output + "\n+++ " + output + " (rendered)\n@@ -1,3 +1,3 @@\n # Test\n \n-Foo baz\n+Foo bar\n"
+	if ok || diff != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(diff))
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	expected := "--- a\n+++ b\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if found := lineDiff("a", "b", a, b); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if found := lineDiff("a", "b", a, a); found != "" {
+		t.Fatalf("Expected no diff. Found %s.", strconv.Quote(found))
+	}
+}
+
+func TestLineDiffNewline(t *testing.T) {
+	expected := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n 1\n-2\n\\ No newline at end of file\n+2\n"
+	if found := lineDiff("a", "b", "1\n2", "1\n2\n"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestRenderDelims(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.LeftDelim, m.RightDelim = "<<", ">>"
+	path := filepath.Join(t.TempDir(), "README.md.tpl")
+	if err := os.WriteFile(path, []byte("<< \"Foo\" | doc >>: {{ T }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	found, err := Render(path, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Foo bar: {{ T }}"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestRenderAll(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	readme, api := filepath.Join(dir, "README.md.tpl"), filepath.Join(dir, "API.md.tpl")
+	if err := os.WriteFile(readme, []byte("# Test\n\n{{ \"Foo\" | doc }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(api, []byte("# API\n\n{{ \"Foo\" | link }}: {{ \"Foo\" | doc }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	found, err := RenderAll(map[string]string{"README.md": readme, "docs/API.md": api}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"README.md":   "# Test\n\nFoo bar\n",
+		"docs/API.md": "# API\n\n[Foo](https://pkg.go.dev/github.com/dave/rebecca/testing#Foo): Foo bar\n",
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d outputs. Found %d.", len(expected), len(found))
+	}
+	for output, e := range expected {
+		if found[output] != e {
+			t.Fatalf("Output: %s. Expected %s. Found %s.", output, strconv.Quote(e), strconv.Quote(found[output]))
+		}
+	}
+
+	if err := os.WriteFile(api, []byte(`{{ "Bar" | doc }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenderAll(map[string]string{"README.md": readme, "docs/API.md": api}, m); err == nil || !strings.HasPrefix(err.Error(), api+":") {
+		t.Fatalf("Expected error for missing doc in %s. Found %v.", api, err)
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := RenderString(`{{ doc "Foo" }}`, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Foo bar"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if _, err := RenderString(`{{ doc "Bar" }}`, m); err == nil || !strings.Contains(err.Error(), "template:1:3:") {
+		t.Fatalf("Expected error for missing doc. Found %v.", err)
+	}
+}
+
+func TestHTMLTemplate(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\n// Foo sends a <b> on a chan.\nfunc Foo() {}\n",
+		"foo_test.go": `package foo
+
+func ExampleFoo() {
+	a <- b
+}
+`,
+	})
+	m.Format = HTML
+	m.HTMLTemplate = true
+	path := filepath.Join(t.TempDir(), "README.html.tpl")
+	tpl := `<h1>{{ "<Foo>" }}</h1>
+<p>{{ "Foo" | synopsis }}</p>
+{{ "Foo" | doc }}
+{{ example "ExampleFoo" "lines=1" }}`
+	if err := os.WriteFile(path, []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	found, err := Render(path, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<h1>&lt;Foo&gt;</h1>
+<p>Foo sends a &lt;b&gt; on a chan.</p>
+<p>Foo sends a &lt;b&gt; on a chan.</p>
+<pre data-line="1"><code class="language-go">a &lt;- b</code></pre>`
+	if found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+
+	// indent takes HTML from the other functions and escapes any other text
+	found, err = RenderString("<blockquote>\n{{ doc \"Foo\" | indent \"  \" }}\n{{ \"<script>\" | indent \"  \" }}\n</blockquote>", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "<blockquote>\n  <p>Foo sends a &lt;b&gt; on a chan.</p>\n  &lt;script&gt;\n</blockquote>"
+	if found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+
+	m.Format = Markdown
+	if _, err := Render(path, m); err == nil {
+		t.Fatal("Expected error for html/template with markdown.")
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	dir := t.TempDir()
+	tpl := filepath.Join(dir, "README.md.tpl")
+	text := "Version {{ version }}. {{ \"Foo\" | doc }} {{ \"Foo\" | synopsis }}\n"
+	if err := os.WriteFile(tpl, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "README.md")
+	funcs := WithFuncs(template.FuncMap{
+		"version":  func() string { return "v1.2.3" },
+		"synopsis": func(in string) string { return "custom " + in },
+	})
+	if err := Process(tpl, output, "github.com/dave/rebecca/testing", "testing", funcs); err != nil {
+		t.Fatal(err)
+	}
+	found, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Version v1.2.3. Foo bar custom Foo\n"; string(found) != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(string(found)))
+	}
+
+	m, err := NewCodeMap("github.com/dave/rebecca/testing", "testing", funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := m.Validate(`{{ version }} {{ "Missing" | synopsis }}`); len(errs) != 0 {
+		t.Fatalf("Expected custom functions to be skipped. Found %v.", errs)
+	}
+}
@@ -0,0 +1,129 @@
+package rebecca
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SnippetFunc returns lines start to end (inclusive, counting from 1) of the
+// named file in the package directory, de-indented, in a fenced code block. It
+// panics if the file can't be read or the lines are out of range.
+func (m *CodeMap) SnippetFunc(file string, start, end int) string {
+	out, err := m.Snippet(file, start, end)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Snippet returns lines start to end of the named file. See SnippetFunc.
+func (m *CodeMap) Snippet(file string, start, end int) (string, error) {
+	lines, err := m.readLines(file)
+	if err != nil {
+		return "", err
+	}
+	if start < 1 || start > len(lines) {
+		return "", fmt.Errorf("line %d out of range (%s has %d lines)", start, file, len(lines))
+	}
+	if end < 1 || end > len(lines) {
+		return "", fmt.Errorf("line %d out of range (%s has %d lines)", end, file, len(lines))
+	}
+	if start > end {
+		return "", fmt.Errorf("start must not be greater than end in %s lines %d to %d", file, start, end)
+	}
+	return m.fence(strings.Join(deindent(lines[start-1:end]), "\n")), nil
+}
+
+// readLines returns the lines of a file, relative to the package directory.
+func (m *CodeMap) readLines(file string) ([]string, error) {
+	if !fs.ValidPath(file) {
+		return nil, fmt.Errorf("invalid file name %s, must be relative to the package directory", file)
+	}
+	b, err := fs.ReadFile(m.fsys, path.Join(m.root, file))
+	if err != nil {
+		return nil, err
+	}
+	s := strings.Replace(string(b), "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n"), nil
+}
+
+// snippetRegex matches the comments delimiting a named snippet.
+var snippetRegex = regexp.MustCompile(`^//\s*rebecca:(snippet\s+(\S+)|end)\s*$`)
+
+// NamedSnippetFunc returns the source between the "// rebecca:snippet name"
+// and "// rebecca:end" comments in the package, de-indented, in a fenced code
+// block. It panics if the snippet is not found.
+func (m *CodeMap) NamedSnippetFunc(name string) string {
+	out, err := m.NamedSnippet(name)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// NamedSnippet returns the named snippet. See NamedSnippetFunc.
+func (m *CodeMap) NamedSnippet(in string) (string, error) {
+	p, name := m.lookup(in)
+	s, ok := p.Snippets[name]
+	if !ok {
+		return "", fmt.Errorf("snippet %s not found", in)
+	}
+	return m.fence(s), nil
+}
+
+// scanSnippets collects the named snippets in the files of p.
+func (m *CodeMap) scanSnippets(name string, p *ast.Package) error {
+	var filenames []string
+	for filename := range p.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		var lines []string
+		var open string
+		var start token.Position
+		for _, g := range p.Files[filename].Comments {
+			for _, c := range g.List {
+				match := snippetRegex.FindStringSubmatch(c.Text)
+				if match == nil {
+					continue
+				}
+				pos := m.fset.Position(c.Pos())
+				switch {
+				case match[1] != "end" && open != "":
+					m.Errors = append(m.Errors, fmt.Errorf("%s: snippet %s starts before the end of snippet %s", pos, match[2], open))
+				case match[1] != "end":
+					open, start = match[2], pos
+				case open == "":
+					m.Errors = append(m.Errors, fmt.Errorf("%s: rebecca:end without rebecca:snippet", pos))
+				default:
+					if _, ok := m.Snippets[open]; ok {
+						m.Errors = append(m.Errors, fmt.Errorf("%s: duplicate snippet %s", start, open))
+						open = ""
+						continue
+					}
+					if lines == nil {
+						var err error
+						if lines, err = m.readLines(filepath.Base(filename)); err != nil {
+							return err
+						}
+					}
+					// the lines between the markers
+					m.Snippets[open] = strings.Join(deindent(lines[start.Line:pos.Line-1]), "\n")
+					open = ""
+				}
+			}
+		}
+		if open != "" {
+			m.Errors = append(m.Errors, fmt.Errorf("%s: snippet %s has no rebecca:end", start, open))
+		}
+	}
+	return nil
+}
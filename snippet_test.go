@@ -0,0 +1,93 @@
+package rebecca
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const snippetTestFile = `package foo
+
+func Serve() {
+	for {
+		if true {
+			break
+		}
+	}
+}
+`
+
+func TestSnippet(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{"server.go": snippetTestFile})
+	tests := map[[2]int]string{
+		{5, 7}: "```go\nif true {\n\tbreak\n}\n```",
+		{3, 3}: "```go\nfunc Serve() {\n```",
+		{9, 9}: "```go\n}\n```",
+	}
+	for r, expected := range tests {
+		found, err := m.Snippet("server.go", r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Range: %v. Expected %s. Found %s.", r, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	failures := map[[2]int]string{
+		{0, 2}:  "line 0 out of range (server.go has 9 lines)",
+		{2, 10}: "line 10 out of range (server.go has 9 lines)",
+		{4, 3}:  "start must not be greater than end",
+	}
+	for r, expected := range failures {
+		if _, err := m.Snippet("server.go", r[0], r[1]); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Range: %v. Expected error %s. Found %v.", r, strconv.Quote(expected), err)
+		}
+	}
+	if _, err := m.Snippet("../server.go", 1, 1); err == nil {
+		t.Fatal("Expected error for file outside the package.")
+	}
+}
+
+func TestNamedSnippet(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"server.go": `package foo
+
+func Serve() {
+	// rebecca:snippet loop
+	for {
+		break // done
+	}
+	// rebecca:end
+}
+
+// rebecca:snippet open
+`,
+		"client.go": `package foo
+
+func Dial() {
+	// rebecca:snippet loop
+	for {
+		// spin
+	}
+	// rebecca:end
+}
+`,
+	})
+	// client.go is scanned first
+	expected := "```go\nfor {\n\t// spin\n}\n```"
+	if found := m.NamedSnippetFunc("loop"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+	if len(m.Errors) != 2 {
+		t.Fatalf("Expected 2 errors. Found %v.", m.Errors)
+	}
+	if !strings.Contains(m.Errors[0].Error(), "server.go:4:2: duplicate snippet loop") {
+		t.Fatalf("Expected duplicate snippet error. Found %v.", m.Errors[0])
+	}
+	if !strings.Contains(m.Errors[1].Error(), "snippet open has no rebecca:end") {
+		t.Fatalf("Expected unclosed snippet error. Found %v.", m.Errors[1])
+	}
+	if _, err := m.NamedSnippet("missing"); err == nil {
+		t.Fatal("Expected error for missing snippet.")
+	}
+}
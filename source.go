@@ -0,0 +1,74 @@
+package rebecca
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSourceRef is the ref used by SourceLinkFunc when CodeMap.SourceRef is
+// empty.
+const DefaultSourceRef = "HEAD"
+
+// SourceLinkFunc returns the URL of the line where the named declaration or
+// example is defined, e.g.
+// "https://github.com/dave/rebecca/blob/HEAD/server.go#L12". The URL is made
+// from m.SourceURL and m.SourceRef. It panics if the name is not found.
+func (m *CodeMap) SourceLinkFunc(in string) string {
+	out, err := m.SourceLink(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// SourceLink returns the URL of the source of the named declaration. See
+// SourceLinkFunc.
+func (m *CodeMap) SourceLink(in string) (string, error) {
+	p, name := m.lookup(in)
+	var pos token.Pos
+	if e, ok := p.Examples[name]; ok {
+		pos = e.Code.Pos()
+	} else if d, ok := p.Decls[name]; ok {
+		pos = d.Pos()
+		if g, ok := d.(*ast.GenDecl); ok {
+			// consts and vars are stored with their group
+			for _, s := range g.Specs {
+				if s, ok := s.(*ast.ValueSpec); ok {
+					for _, n := range s.Names {
+						if n.Name == name {
+							pos = n.Pos()
+						}
+					}
+				}
+			}
+		}
+	} else {
+		return "", m.notFound(in, fmt.Errorf("declaration %s not found", in))
+	}
+
+	base := m.SourceURL
+	var dir string
+	if repo, ok := githubRepo(p.pkg); ok {
+		if base == "" {
+			base = "https://github.com/" + repo
+		}
+		dir = strings.TrimPrefix(strings.TrimPrefix(p.pkg, "github.com/"+repo), "/")
+	} else {
+		if base == "" {
+			return "", fmt.Errorf("source link needs a github.com package or SourceURL, found %s", m.pkg)
+		}
+		// the root package is at the root of the repository
+		dir = strings.TrimPrefix(strings.TrimPrefix(p.pkg, m.pkg), "/")
+	}
+	ref := m.SourceRef
+	if ref == "" {
+		ref = DefaultSourceRef
+	}
+	position := p.fset.Position(pos)
+	file := path.Join(dir, filepath.Base(position.Filename))
+	return fmt.Sprintf("%s/blob/%s/%s#L%d", strings.TrimSuffix(base, "/"), ref, file, position.Line), nil
+}
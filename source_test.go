@@ -0,0 +1,65 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSourceLink(t *testing.T) {
+	fsys := fstest.MapFS{
+		"server.go": {Data: []byte(`package foo
+
+type Conn struct{}
+
+// Close closes.
+func (c *Conn) Close() {}
+
+const (
+	A = 1
+	B = 2
+)
+`)},
+		"server_test.go": {Data: []byte(`package foo
+
+func ExampleConn_Close() {
+}
+`)},
+	}
+	m, err := NewCodeMapFS("github.com/dave/rebecca/server", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"Conn":              "https://github.com/dave/rebecca/blob/HEAD/server/server.go#L3",
+		"Conn.Close":        "https://github.com/dave/rebecca/blob/HEAD/server/server.go#L6",
+		"B":                 "https://github.com/dave/rebecca/blob/HEAD/server/server.go#L10",
+		"ExampleConn_Close": "https://github.com/dave/rebecca/blob/HEAD/server/server_test.go#L3",
+	}
+	for in, expected := range tests {
+		found, err := m.SourceLink(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	if _, err := m.SourceLink("Missing"); err == nil {
+		t.Fatal("Expected error for missing declaration.")
+	}
+
+	m, err = NewCodeMapFS("example.com/foo", fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SourceLink("Conn"); err == nil {
+		t.Fatal("Expected error without SourceURL.")
+	}
+	m.SourceURL = "https://gitlab.com/foo/foo/-/"
+	m.SourceRef = "v1.0.0"
+	expected := "https://gitlab.com/foo/foo/-/blob/v1.0.0/server.go#L6"
+	if found := m.SourceLinkFunc("Conn.Close"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
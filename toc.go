@@ -0,0 +1,96 @@
+package rebecca
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TOCPlaceholder is replaced with a table of contents by InsertTOC.
+const TOCPlaceholder = "<!-- rebecca:toc -->"
+
+var (
+	headingRegex = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	linkRegex    = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	slugRegex    = regexp.MustCompile(`[^\p{L}\p{M}\p{N}\s_-]`)
+)
+
+// TOC returns a nested markdown list linking to the headings in markdown,
+// using the anchors generated by GitHub. Headings in fenced code blocks are
+// ignored.
+func TOC(markdown string) string {
+	type heading struct {
+		level int
+		text  string
+	}
+	var headings []heading
+	var fence string
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if m := headingRegex.FindStringSubmatch(line); m != nil && m[2] != "" {
+			headings = append(headings, heading{level: len(m[1]), text: linkRegex.ReplaceAllString(m[2], "$1")})
+		}
+	}
+	if len(headings) == 0 {
+		return ""
+	}
+
+	top := headings[0].level
+	for _, h := range headings {
+		if h.level < top {
+			top = h.level
+		}
+	}
+	seen := map[string]int{}
+	var lines []string
+	for _, h := range headings {
+		anchor := slug(h.text)
+		if n, ok := seen[anchor]; ok {
+			// duplicates are suffixed -1, -2 etc.
+			seen[anchor] = n + 1
+			anchor = fmt.Sprintf("%s-%d", anchor, n+1)
+		} else {
+			seen[anchor] = 0
+		}
+		text := strings.Replace(h.text, "`", "", -1)
+		lines = append(lines, fmt.Sprintf("%s- [%s](#%s)", strings.Repeat("  ", h.level-top), text, anchor))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// InsertTOC replaces TOCPlaceholder in the rendered markdown with the table of
+// contents of the whole document. Because the headings are only known once
+// the template has been executed, this is run as a second pass.
+func InsertTOC(rendered string) string {
+	if !strings.Contains(rendered, TOCPlaceholder) {
+		return rendered
+	}
+	return strings.Replace(rendered, TOCPlaceholder, TOC(rendered), -1)
+}
+
+// SlugFunc returns the anchor GitHub generates for a heading, as linked by the
+// toc function, e.g. "connclose" for "Conn.Close" or "treek-vinsert" for
+// "Tree[K, V].Insert". This is the anchor of the first heading with the text.
+// GitHub suffixes the anchors of repeated headings with "-1", "-2" etc, which
+// isn't added here, so link the second "Usage" heading as "#usage-1".
+func (m *CodeMap) SlugFunc(in string) string {
+	return slug(in)
+}
+
+// slug returns the GitHub anchor for a heading: lowercase, with links replaced
+// by their text, punctuation removed and spaces replaced by hyphens.
+func slug(text string) string {
+	text = linkRegex.ReplaceAllString(text, "$1")
+	s := slugRegex.ReplaceAllString(strings.ToLower(strings.TrimSpace(text)), "")
+	return strings.Replace(s, " ", "-", -1)
+}
@@ -0,0 +1,55 @@
+package rebecca
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTOC(t *testing.T) {
+	markdown := "# Rebecca\n\n" +
+		"## Install\n\n" +
+		"```\n# not a heading\n```\n\n" +
+		"## Usage\n\n" +
+		"### Doc, Code & Output!\n\n" +
+		"## Usage\n\n" +
+		"### The `doc` [func](https://example.com) ##\n\n" +
+		"## Usage\n"
+	expected := "- [Rebecca](#rebecca)\n" +
+		"  - [Install](#install)\n" +
+		"  - [Usage](#usage)\n" +
+		"    - [Doc, Code & Output!](#doc-code--output)\n" +
+		"  - [Usage](#usage-1)\n" +
+		"    - [The doc func](#the-doc-func)\n" +
+		"  - [Usage](#usage-2)"
+	if found := TOC(markdown); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestInsertTOC(t *testing.T) {
+	rendered := TOCPlaceholder + "\n\n# Foo\n\n## Bar\n"
+	expected := "- [Foo](#foo)\n  - [Bar](#bar)\n\n# Foo\n\n## Bar\n"
+	if found := InsertTOC(rendered); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestSlug(t *testing.T) {
+	m := &CodeMap{}
+	tests := map[string]string{
+		"Conn.Close":                     "connclose",
+		"(*Conn).Close":                  "connclose",
+		"Tree[K, V].Insert":              "treek-vinsert",
+		"Tree[K,V].Insert":               "treekvinsert",
+		"Example (Timeout)":              "example-timeout",
+		"Doc, Code & Output!":            "doc-code--output",
+		"The `doc` [func](https://x.io)": "the-doc-func",
+		"snake_case-name":                "snake_case-name",
+		"  Ünïcode  ":                    "ünïcode",
+	}
+	for in, expected := range tests {
+		if found := m.SlugFunc(in); found != expected {
+			t.Fatalf("Input: %s. Expected %s. Found %s.", in, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+}
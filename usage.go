@@ -0,0 +1,113 @@
+package rebecca
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRunTimeout is the time allowed for building and running a command in
+// HelpFunc when CodeMap.RunTimeout is zero.
+const DefaultRunTimeout = 30 * time.Second
+
+// UsageFunc returns the value of the named string const or var, e.g. the usage
+// text of a command, in a plain code block. It panics if the declaration is
+// not found or isn't a string literal.
+func (m *CodeMap) UsageFunc(name string) string {
+	out, err := m.Usage(name)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Usage returns the value of the named string const or var. See UsageFunc.
+func (m *CodeMap) Usage(in string) (string, error) {
+	p, name := m.lookup(in)
+	d, ok := p.Decls[name].(*ast.GenDecl)
+	if !ok || (d.Tok != token.CONST && d.Tok != token.VAR) {
+		return "", m.notFound(in, fmt.Errorf("const or var %s not found", in))
+	}
+	for _, spec := range d.Specs {
+		s := spec.(*ast.ValueSpec)
+		for i, n := range s.Names {
+			if n.Name != name || i >= len(s.Values) {
+				continue
+			}
+			lit, ok := s.Values[i].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return "", fmt.Errorf("%s is not a string literal", in)
+			}
+			value, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return "", fmt.Errorf("can't unquote %s: %v", in, err)
+			}
+			return m.plainFence(strings.Trim(value, "\n")), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no value", in)
+}
+
+// HelpFunc builds the command in the package directory, runs it with -help and
+// returns the output in a plain code block. Because this runs code, it is only
+// allowed when m.AllowRun is true. It panics if the command can't be run.
+func (m *CodeMap) HelpFunc() string {
+	out, err := m.Help()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Help builds and runs the command with -help. See HelpFunc.
+func (m *CodeMap) Help() (string, error) {
+	if !m.AllowRun {
+		return "", errors.New("running commands is disabled, set AllowRun to enable")
+	}
+	if m.Name != "main" {
+		return "", fmt.Errorf("%s is not a command", m.pkg)
+	}
+	timeout := m.RunTimeout
+	if timeout == 0 {
+		timeout = DefaultRunTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tmp, err := os.MkdirTemp("", "rebecca")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	bin := filepath.Join(tmp, "cmd")
+
+	build := exec.CommandContext(ctx, "go", "build", "-o", bin, ".")
+	build.Dir = m.dir
+	if out, err := build.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("can't build %s: %v: %s", m.pkg, err, strings.TrimSpace(string(out)))
+	}
+
+	// the flag package prints usage to stderr, so capture both
+	buf := &bytes.Buffer{}
+	run := exec.CommandContext(ctx, bin, "-help")
+	run.Dir = m.dir
+	run.Stdout = buf
+	run.Stderr = buf
+	if err := run.Run(); err != nil {
+		// commands often exit with a non-zero status after printing help
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || buf.Len() == 0 || ctx.Err() != nil {
+			return "", fmt.Errorf("can't run %s: %v", m.pkg, err)
+		}
+	}
+	return m.plainFence(strings.Trim(buf.String(), "\n")), nil
+}
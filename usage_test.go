@@ -0,0 +1,79 @@
+package rebecca
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const usageTestCommand = `package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = ` + "`" + `Usage: foo [flags]
+
+Foo does things.
+` + "`" + `
+
+var short = "foo"
+
+var n = 1
+
+func main() {
+	flag.Bool("v", false, "verbose")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+`
+
+func TestUsage(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{"main.go": usageTestCommand})
+	tests := map[string]string{
+		"usage": "```\nUsage: foo [flags]\n\nFoo does things.\n```",
+		"short": "```\nfoo\n```",
+	}
+	for name, expected := range tests {
+		found, err := m.Usage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != expected {
+			t.Fatalf("Name: %s. Expected %s. Found %s.", name, strconv.Quote(expected), strconv.Quote(found))
+		}
+	}
+	for _, name := range []string{"n", "main", "missing"} {
+		if _, err := m.Usage(name); err == nil {
+			t.Fatalf("Name: %s. Expected error.", name)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"go.mod":  "module example.com/foo\n\ngo 1.19\n",
+		"main.go": usageTestCommand,
+	})
+	if _, err := m.Help(); err == nil || !strings.Contains(err.Error(), "AllowRun") {
+		t.Fatalf("Expected disabled error. Found %v.", err)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	m.AllowRun = true
+	found, err := m.Help()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "```\nUsage: foo [flags]\n\nFoo does things.\n  -v\tverbose\n```"
+	if found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
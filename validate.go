@@ -0,0 +1,224 @@
+package rebecca
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// reference is a name passed to one of the template functions.
+type reference struct {
+	fn, name string
+	node     parse.Node
+}
+
+// Validate checks every name passed to the template functions in the template
+// text, e.g. {{ "Foo" | doc }} or {{ example "ExampleFoo" }}, and returns an
+// error for each one that isn't found. Names passed to notes, badge, import
+// and help aren't checked, and neither are names computed by the template.
+func (m *CodeMap) Validate(text string) []error {
+	refs, tree, err := m.references(text)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, r := range refs {
+		if err := m.checkReference(r.fn, r.name); err != nil {
+			location, _ := tree.ErrorContext(r.node)
+			errs = append(errs, fmt.Errorf("%s: %s %q: %v", location, r.fn, r.name, err))
+		}
+	}
+	return errs
+}
+
+// Unreferenced returns the examples, and the documented package level
+// declarations, that aren't referenced by the template text, in sorted order.
+func (m *CodeMap) Unreferenced(text string) ([]string, error) {
+	refs, _, err := m.references(text)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, r := range refs {
+		name := docName(r.name)
+		used[name] = true
+		if r.fn == "examplesfor" {
+			for _, e := range m.ExamplesFor(name) {
+				used["Example"+e.Name] = true
+			}
+		}
+	}
+	var out []string
+	for name := range m.Examples {
+		if !used[name] {
+			out = append(out, name)
+		}
+	}
+	for name := range m.Comments {
+		if strings.Contains(name, ".") || strings.HasSuffix(name, "_go") || used[name] {
+			// members, and file docs
+			continue
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// checkReference reports whether name is found by the template function fn.
+func (m *CodeMap) checkReference(fn, name string) error {
+	if _, ok := m.Funcs[fn]; ok {
+		// not a built-in function
+		return nil
+	}
+	var err error
+	switch fn {
+	case "doc", "plaintext":
+		_, err = m.Doc(name)
+	case "synopsis":
+		_, err = m.Synopsis(name)
+	case "deprecated":
+		_, err = m.Deprecated(name)
+	case "doclinks":
+		_, err = m.DocLinks(name)
+	case "words", "readingtime":
+		_, err = m.WordCount(name)
+	case "example", "collapsible", "code", "output", "truncatedoutput", "outputtable", "outputdiff", "examplewithoutput", "unordered", "playground", "playlink":
+		if _, ok := m.example(name); !ok {
+			err = fmt.Errorf("example %s not found", name)
+		}
+	case "signature":
+		_, err = m.Signature(name)
+	case "aliastarget":
+		_, err = m.AliasTarget(name)
+	case "methods":
+		_, err = m.Methods(name)
+	case "fields":
+		_, err = m.Fields(name)
+	case "decl":
+		_, err = m.Decl(name)
+	case "body":
+		_, err = m.Body(name)
+	case "link":
+		_, err = m.Link(name)
+	case "source":
+		_, err = m.SourceLink(name)
+	case "usage":
+		_, err = m.Usage(name)
+	case "namedsnippet":
+		_, err = m.NamedSnippet(name)
+	case "consts":
+		_, err = m.ConstValues(name)
+	case "entry":
+		_, err = m.Entry(name)
+	case "examplesfor":
+		if len(m.ExamplesFor(name)) == 0 {
+			err = fmt.Errorf("no examples found for %s", name)
+		}
+	}
+	return err
+}
+
+// references parses the template text and returns the string literals passed
+// to the template functions.
+func (m *CodeMap) references(text string) ([]reference, *parse.Tree, error) {
+	tpl, err := template.New("template").
+		Delims(m.LeftDelim, m.RightDelim).
+		Funcs(m.FuncMap()).
+		Parse(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't parse template, %v", err)
+	}
+	if tpl.Tree == nil || tpl.Tree.Root == nil {
+		return nil, nil, errors.New("empty template")
+	}
+	var refs []reference
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			refs = append(refs, pipeReferences(n.Pipe)...)
+		case *parse.IfNode:
+			refs = append(refs, pipeReferences(n.Pipe)...)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			refs = append(refs, pipeReferences(n.Pipe)...)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			refs = append(refs, pipeReferences(n.Pipe)...)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(tpl.Tree.Root)
+	return refs, tpl.Tree, nil
+}
+
+// lastArgFuncs are the template functions that take the name as their last
+// argument, e.g. {{ "ExampleFoo" | collapsible "Show the example" }}.
+var lastArgFuncs = map[string]bool{"collapsible": true}
+
+// pipeReferences returns the string literals passed to functions in a
+// pipeline, either as the first argument or piped from the previous command.
+// See lastArgFuncs for the exceptions.
+func pipeReferences(p *parse.PipeNode) []reference {
+	if p == nil {
+		return nil
+	}
+	var refs []reference
+	var piped *parse.StringNode
+	for _, c := range p.Cmds {
+		var fn string
+		var args []parse.Node
+		for i, arg := range c.Args {
+			switch a := arg.(type) {
+			case *parse.IdentifierNode:
+				if i == 0 {
+					fn = a.Ident
+				}
+			case *parse.PipeNode:
+				refs = append(refs, pipeReferences(a)...)
+			}
+			if i > 0 {
+				args = append(args, arg)
+			}
+		}
+		switch {
+		case fn == "":
+		case fn == "packageexample":
+			// takes options, and always refers to the package example
+			refs = append(refs, reference{fn: fn, name: "Example", node: c})
+		case lastArgFuncs[fn] && piped != nil:
+			refs = append(refs, reference{fn: fn, name: piped.Text, node: piped})
+		case lastArgFuncs[fn]:
+			if len(args) > 1 {
+				if s, ok := args[len(args)-1].(*parse.StringNode); ok {
+					refs = append(refs, reference{fn: fn, name: s.Text, node: s})
+				}
+			}
+		case len(args) > 0:
+			if s, ok := args[0].(*parse.StringNode); ok {
+				refs = append(refs, reference{fn: fn, name: s.Text, node: s})
+			}
+		case piped != nil:
+			refs = append(refs, reference{fn: fn, name: piped.Text, node: piped})
+		}
+		piped = nil
+		if len(c.Args) == 1 {
+			piped, _ = c.Args[0].(*parse.StringNode)
+		}
+	}
+	return refs
+}
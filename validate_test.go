@@ -0,0 +1,59 @@
+package rebecca
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": `package foo
+
+// Foo is foo. It does things.
+func Foo() {}
+
+// Bar is bar.
+func Bar() {}
+`,
+		"foo_test.go": `package foo
+
+func ExampleFoo() {
+	Foo()
+}
+
+func ExampleBar() {
+	Bar()
+}
+`,
+	})
+	tpl := `# Test
+{{ "Foo[1]" | doc }}
+{{ "ExampleFoo" | example }}
+{{ if "ExampleFoo" | unordered }}{{ doc "Baz" }}{{ end }}
+{{ "ExampleBaz" | code }}
+{{ "Foo" | badge }}
+`
+	errs := m.Validate(tpl)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors. Found %v.", errs)
+	}
+	expected := []string{`template:4:40: doc "Baz": doc for Baz not found, did you mean Bar?`, `template:5:3: code "ExampleBaz": example ExampleBaz not found`}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected[i]), strconv.Quote(err.Error()))
+		}
+	}
+
+	unused, err := m.Unreferenced(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := strings.Join(unused, " "); found != "Bar ExampleBar" {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote("Bar ExampleBar"), strconv.Quote(found))
+	}
+
+	if errs := m.Validate("{{ doc "); len(errs) != 1 {
+		t.Fatalf("Expected parse error. Found %v.", errs)
+	}
+}
@@ -0,0 +1,141 @@
+package rebecca
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VerifyExamples runs the examples in the package that have an output comment
+// with go test, and returns an error for each one whose output differs. This
+// catches examples in the readme whose output has changed. Because this runs
+// code, it is only allowed when m.AllowRun is true, and it is limited by
+// m.RunTimeout.
+func (m *CodeMap) VerifyExamples() []error {
+	if !m.AllowRun {
+		return []error{errors.New("running examples is disabled, set AllowRun to enable")}
+	}
+	var names []string
+	for name, e := range m.Examples {
+		if e.Output != "" || e.EmptyOutput {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	timeout := m.RunTimeout
+	if timeout == 0 {
+		timeout = DefaultRunTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "test", "-json", "-run", "^("+strings.Join(names, "|")+")$", ".")
+	cmd.Dir = m.dir
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return []error{fmt.Errorf("can't run examples for %s: %v", m.pkg, ctx.Err())}
+	}
+
+	// go test -json prints an event per line, except for build errors
+	type event struct {
+		Action, Test, Output string
+	}
+	outputs := map[string]string{}
+	var failed []string
+	var other string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var e event
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			other += scanner.Text() + "\n"
+			continue
+		}
+		switch {
+		case e.Test == "":
+			continue
+		case e.Action == "fail":
+			failed = append(failed, e.Test)
+		case e.Action == "output" && !strings.HasPrefix(e.Output, "=== ") && !strings.HasPrefix(e.Output, "--- "):
+			outputs[e.Test] += e.Output
+		}
+	}
+	if len(failed) == 0 && err != nil {
+		return []error{fmt.Errorf("can't run examples for %s: %v: %s", m.pkg, err, strings.TrimSpace(other))}
+	}
+	var errs []error
+	for _, name := range failed {
+		errs = append(errs, fmt.Errorf("%s: output differs:\n%s", name, strings.TrimRight(outputs[name], "\n")))
+	}
+	return errs
+}
+
+// ExamplesWithoutOutput returns the names of the examples that have no output
+// comment, so go test compiles them but doesn't run them, in the order of
+// ExampleNames. Examples with an empty "// Output:" comment are run, so they
+// aren't included.
+func (m *CodeMap) ExamplesWithoutOutput() []string {
+	var names []string
+	for _, name := range m.ExampleNames() {
+		if e := m.Examples[name]; e.Output == "" && !e.EmptyOutput {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// VerifyExamplesFormatted returns an error for each example function whose
+// source isn't formatted as gofmt would, so the code printed in the readme
+// matches the test file exactly.
+func (m *CodeMap) VerifyExamplesFormatted() []error {
+	var errs []error
+	for _, f := range m.files {
+		name := m.fset.File(f.Pos()).Name()
+		if !strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		var src []byte
+		for _, d := range f.Decls {
+			d, ok := d.(*ast.FuncDecl)
+			if !ok || d.Recv != nil || m.Examples[d.Name.Name] == nil {
+				continue
+			}
+			if src == nil {
+				var err error
+				if src, err = m.readSource(path.Base(filepath.ToSlash(name))); err != nil {
+					errs = append(errs, err)
+					break
+				}
+			}
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			code := string(src[m.fset.Position(start).Offset:m.fset.Position(d.End()).Offset])
+			formatted, err := format.Source([]byte("package p\n\n" + code))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: can't format %s: %v", m.fset.Position(d.Pos()), d.Name.Name, err))
+				continue
+			}
+			if strings.TrimPrefix(string(formatted), "package p\n\n") != code+"\n" {
+				errs = append(errs, fmt.Errorf("%s: %s isn't gofmt-clean", m.fset.Position(d.Pos()), d.Name.Name))
+			}
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
@@ -0,0 +1,103 @@
+package rebecca
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVerifyExamples(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"go.mod": "module example.com/foo\n\ngo 1.19\n",
+		"foo.go": "package foo\n\nfunc Foo() string { return \"foo\" }\n",
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleFoo() {
+	fmt.Println(Foo())
+	// Output: foo
+}
+
+func ExampleFoo_stale() {
+	fmt.Println(Foo())
+	// Output: bar
+}
+
+func ExampleFoo_noOutput() {
+	panic("not run")
+}
+`,
+	})
+	if errs := m.VerifyExamples(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "AllowRun") {
+		t.Fatalf("Expected disabled error. Found %v.", errs)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	m.AllowRun = true
+	errs := m.VerifyExamples()
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error. Found %v.", errs)
+	}
+	expected := "ExampleFoo_stale: output differs:\ngot:\nfoo\nwant:\nbar"
+	if found := errs[0].Error(); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestVerifyExamplesFormatted(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": "package foo\n\nimport \"fmt\"\n\n" +
+			"// ExampleA is formatted.\nfunc ExampleA() {\n\ta := 1  // one\n\tbb := 2 // two\n\tfmt.Println(a, bb)\n}\n\n" +
+			"func ExampleB() {\n\tb:=1\n\tfmt.Println(b)\n}\n\n" +
+			"func helper() {\n\tx:=1\n\t_ = x\n}\n",
+	})
+	errs := m.VerifyExamplesFormatted()
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), "foo_test.go:12:1: ExampleB isn't gofmt-clean") {
+		t.Fatalf("Expected one error for ExampleB. Found %v.", errs)
+	}
+	expected := "```go\na := 1  // one\nbb := 2 // two\nfmt.Println(a, bb)\n```"
+	if found := m.ExampleFunc(false)("ExampleA"); found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}
+
+func TestExamplesWithoutOutput(t *testing.T) {
+	m := newTestCodeMap(t, map[string]string{
+		"foo.go": "package foo\n\ntype T struct{}\n\nfunc (T) M() {}\n",
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleT() {
+	fmt.Println("t")
+	// Output: t
+}
+
+func ExampleT_M() {
+	T{}.M()
+}
+
+func ExampleT_empty() {
+	T{}.M()
+	// Output:
+}
+
+func ExampleT_unordered() {
+	fmt.Println("a")
+	// Unordered output: a
+}
+
+func Example() {
+	T{}.M()
+}
+`,
+	})
+	found := strings.Join(m.ExamplesWithoutOutput(), " ")
+	if expected := "Example ExampleT_M"; found != expected {
+		t.Fatalf("Expected %s. Found %s.", strconv.Quote(expected), strconv.Quote(found))
+	}
+}